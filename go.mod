@@ -0,0 +1,3 @@
+module github.com/TriggerMail/rules_pyz
+
+go 1.17
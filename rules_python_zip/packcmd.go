@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TriggerMail/rules_pyz/rules_python_zip/simplepack"
+)
+
+// First argument that selects packing from flags instead of a manifest file
+const packCommand = "pack"
+
+// A flag that can be repeated, e.g. --wheel a.whl --wheel b.whl.
+type stringListFlag []string
+
+func (l *stringListFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringListFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// A repeated flag of KEY=VALUE pairs.
+type stringMapFlag map[string]string
+
+func (m stringMapFlag) String() string {
+	pairs := []string{}
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m stringMapFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("must be KEY=VALUE: %#v", value)
+	}
+	m[parts[0]] = parts[1]
+	return nil
+}
+
+// A repeated flag of SRC or SRC=DST. Without DST, the file or directory is packed under its
+// base name.
+type sourcesFlag []simplepack.ManifestSource
+
+func (s *sourcesFlag) String() string {
+	pairs := []string{}
+	for _, source := range *s {
+		pairs = append(pairs, source.Src+"="+source.Dst)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s *sourcesFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	src := parts[0]
+	if src == "" {
+		return fmt.Errorf("must be SRC or SRC=DST: %#v", value)
+	}
+	dst := filepath.Base(src)
+	if len(parts) == 2 {
+		dst = parts[1]
+	}
+	*s = append(*s, simplepack.ManifestSource{Src: src, Dst: filepath.ToSlash(dst)})
+	return nil
+}
+
+// Parses the pack command's flags into a manifest and the output path. Errors are also
+// printed to errOutput, with the usage if a flag is invalid.
+func parsePackFlags(args []string, errOutput io.Writer) (*simplepack.Manifest, string, error) {
+	m := &simplepack.Manifest{EntryPoints: map[string]string{}, DefaultEnv: map[string]string{}}
+	flags := flag.NewFlagSet(packCommand, flag.ContinueOnError)
+	flags.SetOutput(errOutput)
+	var sources sourcesFlag
+	flags.Var(&sources, "src",
+		"SRC[=DST]: file or directory to pack at DST; defaults to the base name of SRC")
+	flags.Var((*stringListFlag)(&m.Wheels), "wheel", "wheel to pack")
+	flags.Var((*stringListFlag)(&m.PreferredWheels), "prefer-wheel",
+		"wheel to pack when another wheel installs the same project")
+	flags.StringVar(&m.EntryPoint, "entry-point", "", "module or module:function to run")
+	flags.Var(stringMapFlag(m.EntryPoints), "command",
+		"NAME=ENTRY_POINT: command of a multicall binary")
+	flags.BoolVar(&m.Interpreter, "interpreter", false, "act like a Python interpreter")
+	flags.StringVar(&m.InterpreterPath, "python-shebang", "",
+		"interpreter for the #! line; defaults to "+simplepack.DefaultInterpreterLine)
+	flags.StringVar(&m.PythonVersion, "python-version", "",
+		"Python version the zip runs with; defaults to the --python-shebang version")
+	flags.Var((*stringListFlag)(&m.ForceUnzip), "force-unzip",
+		"path in the zip, or wheel, to extract before running")
+	flags.BoolVar(&m.ForceAllUnzip, "force-all-unzip", false, "extract everything before running")
+	flags.StringVar(&m.ExtractRoot, "extract-root", "", "directory for extracted files")
+	flags.StringVar(&m.ZipSafetyCheck, "zip-safety-check", "", "warn, error or unzip")
+	flags.StringVar(&m.ImportCheck, "import-check", "", "warn or error")
+	flags.StringVar(&m.RequiresPythonCheck, "requires-python-check", "",
+		"warn or error: check the Requires-Python of the wheels")
+	flags.BoolVar(&m.TreeShake, "tree-shake", false,
+		"drop modules that the entry point cannot import")
+	flags.BoolVar(&m.SourceMapTracebacks, "source-map-tracebacks", false,
+		"show source paths in tracebacks")
+	flags.BoolVar(&m.SubprocessReentry, "subprocess-reentry", false,
+		"let child processes run the packed console scripts")
+	flags.Var((*stringListFlag)(&m.InitModules), "init-module",
+		"module or module:function to run before the entry point")
+	flags.Var(stringMapFlag(m.DefaultEnv), "default-env",
+		"KEY=VALUE: environment variable to set if it is not set")
+	flags.Var((*stringListFlag)(&m.DefaultArgs), "default-arg",
+		"argument to insert before the command line arguments")
+	flags.StringVar(&m.SourceSymlinks, "source-symlinks", "",
+		"store: pack symlinks in source directories as symlinks; requires --output-format")
+	flags.StringVar(&m.OutputFormat, "output-format", "", "dir, tar, tar.gz or oci_layer")
+	flags.StringVar(&m.InstallPrefix, "install-prefix", "",
+		"directory in a tarball to put the files in")
+	flags.BoolVar(&m.SBOM, "sbom", false,
+		"embed an SPDX bill of materials and the wheels' license notices")
+	flags.StringVar(&m.LicenseCheck, "license-check", "",
+		"warn or error: report wheels with missing or unknown licenses")
+	flags.StringVar(&m.SigningKey, "signing-key", "", "PEM ed25519 private key to sign with")
+	flags.StringVar(&m.SignatureCheck, "signature-check", "",
+		"warn or error: check the signature at startup")
+	flags.Var((*stringListFlag)(&m.TrustedKeys), "trusted-key",
+		"PEM public key the startup check trusts; defaults to the signing key")
+	outputPath := ""
+	flags.StringVar(&outputPath, "o", "", "output path")
+	err := flags.Parse(args)
+	if err == nil && flags.NArg() > 0 {
+		err = fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+		fmt.Fprintln(errOutput, "Error: "+err.Error())
+	} else if err == nil && outputPath == "" {
+		err = fmt.Errorf("-o is required")
+		fmt.Fprintln(errOutput, "Error: "+err.Error())
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	m.Sources = sources
+	return m, outputPath, nil
+}
+
+// Runs the pack command: packs the manifest described by args, and prints it as JSON so the
+// same output can be built with "simplepack (manifest.json) (output)". Nothing is printed if
+// packing fails.
+func packFromFlags(args []string) {
+	zipManifest, outputPath, err := parsePackFlags(args, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	// encoded before packing, which expands the source directories
+	manifestJSON := &bytes.Buffer{}
+	encoder := json.NewEncoder(manifestJSON)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(zipManifest)
+	if err != nil {
+		panic(err)
+	}
+	pack(zipManifest, outputPath)
+	_, err = manifestJSON.WriteTo(os.Stdout)
+	if err != nil {
+		panic(err)
+	}
+}
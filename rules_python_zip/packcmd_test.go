@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/TriggerMail/rules_pyz/rules_python_zip/simplepack"
+)
+
+func TestParsePackFlags(t *testing.T) {
+	m, outputPath, err := parsePackFlags([]string{
+		"--src", "src/pkg", "--src", "tools/run.py=bin/run.py", "--wheel", "a.whl",
+		"--wheel", "b.whl", "--entry-point", "pkg.cli:main", "--default-env", "A=b=c",
+		"--python-shebang", "/usr/bin/env python3", "-o", "out.pyz",
+	}, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputPath != "out.pyz" {
+		t.Errorf("outputPath=%#v; expected out.pyz", outputPath)
+	}
+	expectedSources := []simplepack.ManifestSource{
+		{Src: "src/pkg", Dst: "pkg"},
+		{Src: "tools/run.py", Dst: "bin/run.py"},
+	}
+	if !reflect.DeepEqual(m.Sources, expectedSources) {
+		t.Errorf("Sources=%#v; expected %#v", m.Sources, expectedSources)
+	}
+	if !reflect.DeepEqual(m.Wheels, []string{"a.whl", "b.whl"}) {
+		t.Errorf("Wheels=%#v", m.Wheels)
+	}
+	if m.EntryPoint != "pkg.cli:main" || m.InterpreterPath != "/usr/bin/env python3" ||
+		m.DefaultEnv["A"] != "b=c" {
+		t.Errorf("unexpected manifest: %#v", m)
+	}
+
+	// the printed manifest builds the same zip
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &simplepack.Manifest{}
+	err = json.Unmarshal(data, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, m) {
+		t.Errorf("decoded=%#v; expected %#v", decoded, m)
+	}
+	// with the keys rules_python_zip.bzl writes
+	keys := map[string]interface{}{}
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"entry_point", "coverage", "sbom", "layer", "layers", "target", "stamp"} {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("the printed manifest does not have %#v", key)
+		}
+	}
+
+	invalid := [][]string{
+		{"--src", "a.py"},
+		{"--src", "a.py", "-o", "out.pyz", "extra"},
+		{"--default-env", "A", "-o", "out.pyz"},
+		{"--src", "=a.py", "-o", "out.pyz"},
+	}
+	for _, args := range invalid {
+		_, _, err = parsePackFlags(args, ioutil.Discard)
+		if err == nil {
+			t.Errorf("parsePackFlags(%#v) err=nil; expected error", args)
+		}
+	}
+}
@@ -29,6 +29,7 @@ _pyz_attrs = {
         allow_single_file = True,
         default = Label("//tools:simplepack"),
     ),
+    # files or directories, like generated code from a rule that outputs a tree artifact
     "data": attr.label_list(
         allow_files = True,
         cfg = "data",
@@ -140,11 +141,13 @@ pyz_library = rule(
 )
 
 def _pyz_binary_impl(ctx):
-    main_options_count = (int(len(ctx.files.srcs) > 0) + int(ctx.attr.entry_point != "") +
-        int(ctx.attr.interpreter))
+    # srcs can contain the scripts for entry_points
+    has_main_srcs = len(ctx.files.srcs) > 0 and len(ctx.attr.entry_points) == 0
+    main_options_count = (int(has_main_srcs) + int(ctx.attr.entry_point != "") +
+        int(ctx.attr.interpreter) + int(len(ctx.attr.entry_points) > 0))
     if main_options_count != 1:
-        fail("must specify exactly one of srcs OR entry_point OR interpreter; specified %d" % (
-            main_options_count))
+        fail("must specify exactly one of srcs OR entry_point OR entry_points OR interpreter; " +
+            "specified %d" % (main_options_count))
 
     provider = _get_transitive_provider(ctx)
 
@@ -160,53 +163,349 @@ def _pyz_binary_impl(ctx):
                 transitive_force_unzip=provider.transitive_force_unzip,
             )
 
-    manifest = struct(
+    # srcs are the tests: __main__.py runs them with pytest
+    pytest_tests = []
+    if ctx.attr.pytest:
+        pythonroot = get_pythonroot(ctx)
+        prefix = "####notaprefix#####/"
+        if pythonroot != None:
+            prefix = pythonroot + "/"
+        pytest_tests = [_get_destination_path(prefix, f) for f in ctx.files.srcs]
+
+    outputs = [ctx.outputs.executable]
+    # first-party sources for coverage tools; embedded and collected with bazel coverage
+    coverage_manifest = None
+    if ctx.configuration.coverage_enabled:
+        coverage_manifest = ctx.actions.declare_file(ctx.label.name + ".coverage.json")
+        outputs.append(coverage_manifest)
+    tree_shake_report = None
+    if ctx.attr.tree_shake:
+        tree_shake_report = ctx.actions.declare_file(ctx.label.name + ".tree_shake.txt")
+        outputs.append(tree_shake_report)
+
+    sbom_file = None
+    notices_file = None
+    if ctx.attr.sbom:
+        sbom_file = ctx.actions.declare_file(ctx.label.name + ".spdx.json")
+        notices_file = ctx.actions.declare_file(ctx.label.name + ".THIRD_PARTY_NOTICES")
+        outputs += [sbom_file, notices_file]
+
+    # prebuilt wheel entries: a change to srcs only repacks srcs and copies the layer
+    layers = []
+    if ctx.attr.deps_layer:
+        layer = ctx.actions.declare_file(ctx.label.name + ".deps_layer.zip")
+        layer_manifest_file = ctx.actions.declare_file(ctx.label.name + ".deps_layer_manifest")
+        layer_manifest = struct(
+            wheels=[f.path for f in provider.transitive_wheels],
+            layer=True,
+        )
+        ctx.actions.write(layer_manifest_file, layer_manifest.to_json())
+        ctx.actions.run(
+            inputs=depset(
+                direct=[ctx.file._simplepack, layer_manifest_file],
+                transitive=[provider.transitive_wheels],
+            ),
+            outputs=[layer],
+            arguments=[layer_manifest_file.path, layer.path],
+            executable=ctx.executable._simplepack,
+            mnemonic="PackPyZLayer"
+        )
+        layers.append(layer)
+
+    # workspace status files: see bazel build --workspace_status_command
+    stamp_files = []
+    if ctx.attr.stamp:
+        stamp_files = [ctx.info_file, ctx.version_file]
+    key_files = ctx.files.trusted_keys
+    if ctx.file.signing_key:
+        key_files = [ctx.file.signing_key] + key_files
+
+    manifest_fields = dict(
         sources=provider.transitive_src_mappings.to_list(),
         wheels=[f.path for f in provider.transitive_wheels],
+        preferred_wheels=ctx.attr.preferred_wheels,
         entry_point=ctx.attr.entry_point,
+        entry_points=ctx.attr.entry_points,
         interpreter=ctx.attr.interpreter,
+        pytest_tests=pytest_tests,
         interpreter_path=ctx.attr.interpreter_path,
         force_unzip=provider.transitive_force_unzip.to_list(),
         force_all_unzip=ctx.attr.force_all_unzip,
+        extract_root=ctx.attr.extract_root,
+        zip_safety_check=ctx.attr.zip_safety_check,
+        zip_safety_ignore=ctx.attr.zip_safety_ignore,
+        python_version=ctx.attr.python_version,
+        import_check=ctx.attr.import_check,
+        import_check_allow=ctx.attr.import_check_allow,
+        requires_python_check=ctx.attr.requires_python_check,
+        tree_shake=ctx.attr.tree_shake,
+        tree_shake_keep=ctx.attr.tree_shake_keep,
+        tree_shake_report=tree_shake_report.path if tree_shake_report else "",
+        source_map_tracebacks=ctx.attr.source_map_tracebacks,
+        subprocess_reentry=ctx.attr.subprocess_reentry,
+        sys_path=struct(
+            isolation=ctx.attr.sys_path_isolation,
+            allow_paths=ctx.attr.sys_path_allow,
+            allow_distributions=ctx.attr.sys_path_allow_distributions,
+            interpreter_flags=ctx.attr.interpreter_flags,
+        ),
+        init_modules=ctx.attr.init_modules,
+        default_env=ctx.attr.default_env,
+        default_args=ctx.attr.default_args,
+        coverage=ctx.configuration.coverage_enabled,
+        coverage_manifest=coverage_manifest.path if coverage_manifest else "",
+        # only unpacked formats can store symlinks
+        source_symlinks="",
+        layers=[f.path for f in layers],
+        target=str(ctx.label),
+        stamp=ctx.attr.stamp_values,
+        stamp_files=[f.path for f in stamp_files],
+        sbom=ctx.attr.sbom,
+        sbom_file=sbom_file.path if sbom_file else "",
+        notices_file=notices_file.path if notices_file else "",
+        license_check=ctx.attr.license_check,
+        signing_key=ctx.file.signing_key.path if ctx.file.signing_key else "",
+        signature_check=ctx.attr.signature_check,
+        trusted_keys=[f.path for f in ctx.files.trusted_keys],
     )
+    manifest = struct(**manifest_fields)
 
     manifest_file = ctx.new_file(ctx.configuration.bin_dir, ctx.outputs.executable, '_manifest')
     ctx.actions.write(manifest_file, manifest.to_json())
 
     # package all files into a zip
     inputs = depset(
-        direct=[ctx.file._simplepack, manifest_file],
+        direct=[ctx.file._simplepack, manifest_file] + stamp_files + layers + key_files,
         transitive=[provider.transitive_srcs, provider.transitive_wheels]
     )
     ctx.actions.run(
         inputs=inputs,
-        outputs=[ctx.outputs.executable],
+        outputs=outputs,
         arguments=[manifest_file.path, ctx.outputs.executable.path],
         executable=ctx.executable._simplepack,
         mnemonic="PackPyZ"
     )
 
-pyz_binary = rule(
-    _pyz_binary_impl,
-    attrs = _pyz_attrs + {
-        "entry_point": attr.string(default = ""),
+    output_groups = {}
+    if coverage_manifest:
+        output_groups["coverage_manifest"] = depset([coverage_manifest])
+    if tree_shake_report:
+        output_groups["tree_shake_report"] = depset([tree_shake_report])
+    if sbom_file:
+        output_groups["sbom"] = depset([sbom_file, notices_file])
+
+    # the same files in another format, e.g. for container images
+    if ctx.attr.output_format != "":
+        package_outputs = []
+        oci_metadata = None
+        if ctx.attr.output_format == "dir":
+            package = ctx.actions.declare_directory(ctx.label.name + ".unpacked")
+        elif ctx.attr.output_format == "oci_layer":
+            package = ctx.actions.declare_file(ctx.label.name + ".layer.tar.gz")
+            oci_metadata = ctx.actions.declare_file(ctx.label.name + ".layer.json")
+            package_outputs.append(oci_metadata)
+        else:
+            package = ctx.actions.declare_file(ctx.label.name + "." + ctx.attr.output_format)
+        package_outputs.append(package)
+
+        package_manifest = struct(**dict(
+            manifest_fields,
+            output_format=ctx.attr.output_format,
+            install_prefix=ctx.attr.install_prefix,
+            oci_metadata=oci_metadata.path if oci_metadata else "",
+            oci_entrypoint=ctx.attr.oci_entrypoint,
+            source_symlinks=ctx.attr.source_symlinks,
+            # written by the main action
+            tree_shake_report="",
+            coverage_manifest="",
+            sbom_file="",
+            notices_file="",
+            # only zips are signed
+            signing_key="",
+            signature_check="",
+            trusted_keys=[],
+        ))
+        package_manifest_file = ctx.actions.declare_file(ctx.label.name + ".package_manifest")
+        ctx.actions.write(package_manifest_file, package_manifest.to_json())
+        ctx.actions.run(
+            inputs=depset(direct=[package_manifest_file], transitive=[inputs]),
+            outputs=package_outputs,
+            arguments=[package_manifest_file.path, package.path],
+            executable=ctx.executable._simplepack,
+            mnemonic="PackPyZPackage"
+        )
+        output_groups["package"] = depset(package_outputs)
+    return [OutputGroupInfo(**output_groups)]
+
+_pyz_binary_attrs = _pyz_attrs + {
+    "entry_point": attr.string(default = ""),
+
+    # Command name to entry point, for one binary that runs several commands. The command
+    # is chosen by the name the binary is invoked as (e.g. a symlink) or by the first
+    # argument. Entry points are a module, "module:function" or the path of a script in srcs.
+    "entry_points": attr.string_dict(),
+
+    # If True, act like a Python interpreter: accepts the common python command line options,
+    # like -c, -m, -i, -u, -W, -E and -, and runs scripts or an interactive shell
+    "interpreter": attr.bool(default = False),
+    # If True, srcs are test files that the binary runs with pytest, which must be in deps.
+    # Supports Bazel's test sharding, JUnit XML output and --test_filter (passed to pytest -k).
+    "pytest": attr.bool(default = False),
+
+    # Path to the Python interpreter to write as the #! line on the zip.
+    "interpreter_path": attr.string(default = ""),
+
+    # Forces the contents of the pyz_binary to be extracted and run from a temp dir.
+    "force_all_unzip": attr.bool(default = False),
+    # Directory for files extracted at runtime, like native code. The PYZ_TMPDIR environment
+    # variable overrides it. Defaults to the system temporary directory. Directories left by
+    # processes that were killed are removed the next time a binary extracts files there.
+    "extract_root": attr.string(default = ""),
+
+    # Scan packed Python code for patterns that do not work inside a zip.
+    # "warn" reports them, "error" fails the build, "unzip" unzips the affected packages.
+    "zip_safety_check": attr.string(
+        default = "",
+        values = ["", "warn", "error", "unzip"],
+    ),
+    # Paths or path patterns within the zip to exclude from zip_safety_check.
+    "zip_safety_ignore": attr.string_list(),
+
+    # Python version the binary runs with, e.g. "2.7" or "3.6". Defaults to the version in
+    # interpreter_path, or 2.7.
+    "python_version": attr.string(default = ""),
+
+    # Check that imports in srcs can be resolved from deps or the standard library.
+    # "warn" reports missing imports, "error" fails the build.
+    "import_check": attr.string(
+        default = "",
+        values = ["", "warn", "error"],
+    ),
+    # Modules that may be missing, e.g. optional or platform-specific imports.
+    "import_check_allow": attr.string_list(),
+    # "warn" or "error": check the Requires-Python of the wheels against python_version, or the
+    # interpreter's version. The zip also checks the running interpreter at startup.
+    "requires_python_check": attr.string(
+        default = "",
+        values = ["", "warn", "error"],
+    ),
 
-        # If True, act like a Python interpreter: interactive shell or execute scripts
-        "interpreter": attr.bool(default = False),
+    # Drop modules that cannot be reached by following imports from the entry point. The
+    # list of dropped files is in the tree_shake_report output group.
+    "tree_shake": attr.bool(default = False),
+    # Modules to keep even if they are not imported, e.g. "mypkg.plugins.*" for modules
+    # that are loaded dynamically.
+    "tree_shake_keep": attr.string_list(),
+
+    # Rewrite file names in tracebacks and log records from paths inside the zip to
+    # workspace paths, or wheel name and version for third-party code.
+    "source_map_tracebacks": attr.bool(default = False),
+
+    # Put wrappers for the console scripts of deps and entry_points on PATH, so child
+    # processes can run them from this binary. Also makes multiprocessing start children
+    # that can import from this binary. See pyz_runtime.reentry.
+    "subprocess_reentry": attr.bool(default = False),
+
+    # Which paths of the host Python installation are removed from sys.path. By default
+    # site-packages is removed; "strict" also removes dist-packages and the user site
+    # directory, and "none" keeps everything.
+    "sys_path_isolation": attr.string(
+        default = "",
+        values = ["", "strict", "none"],
+    ),
+    # Host paths to keep on sys.path, e.g. where a vendor SDK is installed.
+    "sys_path_allow": attr.string_list(),
+    # Distributions installed on the host that can be imported, e.g. "vendor-sdk".
+    "sys_path_allow_distributions": attr.string_list(),
+    # Interpreter flags the binary must run with: any of "-I", "-s" and "-E". The binary
+    # re-executes itself with them if needed.
+    "interpreter_flags": attr.string_list(),
+
+    # Modules imported before the entry point, in order, e.g. "gevent.monkey:patch_all".
+    # "module:function" also calls the function with no arguments.
+    "init_modules": attr.string_list(),
+    # Environment variables to set when the binary starts, unless they are already set.
+    "default_env": attr.string_dict(),
+    # Arguments inserted before the arguments the binary is run with.
+    "default_args": attr.string_list(),
+
+    # How to pack symlinks in directories (tree artifacts) in srcs or data of this binary
+    # and its deps in the output_format package: "" packs what they point to, "store" packs
+    # them as symlinks, which must point to a relative path in the package. The executable
+    # zip always packs what they point to: zipimport cannot read symlinks.
+    "source_symlinks": attr.string(
+        default = "",
+        values = ["", "store"],
+    ),
 
-        # Path to the Python interpreter to write as the #! line on the zip.
-        "interpreter_path": attr.string(default = ""),
+    # Pack the wheels of deps into a separate layer zip that is copied into the binary,
+    # so changing srcs does not repack every wheel. The output is the same either way.
+    "deps_layer": attr.bool(default = False),
 
-        # Forces the contents of the pyz_binary to be extracted and run from a temp dir.
-        "force_all_unzip": attr.bool(default = False),
-        "_setuptools_whl": attr.label(
-            allow_single_file = True,
-            default = Label("@pypi_setuptools//file"),
-        ),
-    },
+    # File names of the wheels to pack when deps bring in more than one version of a project,
+    # e.g. "six-1.11.0-py2.py3-none-any.whl". Packing a project twice fails the build otherwise.
+    "preferred_wheels": attr.string_list(),
+
+    # Also pack the files as "dir" (an unpacked directory that runs with python), "tar",
+    # "tar.gz" or "oci_layer" (a gzipped tar for a container image, with a JSON file of
+    # its digests and entrypoint), in the package output group.
+    "output_format": attr.string(
+        default = "",
+        values = ["", "dir", "tar", "tar.gz", "oci_layer"],
+    ),
+    # Directory to put the files in for "tar", "tar.gz" and "oci_layer". Defaults to the
+    # root, or /app for "oci_layer".
+    "install_prefix": attr.string(default = ""),
+    # Entrypoint of the container image for "oci_layer". Defaults to interpreter_path and
+    # install_prefix.
+    "oci_entrypoint": attr.string_list(),
+
+    # Embed an SPDX bill of materials and the license notices of the packed wheels, read from
+    # their dist-info. Also written to the sbom output group.
+    "sbom": attr.bool(default = False),
+    # "warn" or "error": report wheels whose license is missing or unknown.
+    "license_check": attr.string(
+        default = "",
+        values = ["", "warn", "error"],
+    ),
+
+    # PEM ed25519 private key to sign the zip's entries with. Check the signature with
+    # "simplepack verify (zip) (public key)".
+    "signing_key": attr.label(allow_single_file = True),
+    # "warn" or "error": check the signature when the zip starts. This detects modified or
+    # corrupted zips, not someone who can replace the startup code.
+    "signature_check": attr.string(
+        default = "",
+        values = ["", "warn", "error"],
+    ),
+    # PEM public keys the startup check trusts. Defaults to the signing_key's public key.
+    "trusted_keys": attr.label_list(allow_files = True),
+
+    # Embed the workspace status values (stable-status.txt and volatile-status.txt). They
+    # can be read with pyz_runtime.info or printed by running the binary with --pyz-info.
+    "stamp": attr.bool(default = False),
+    # Additional values to embed, available in the same way as stamped values.
+    "stamp_values": attr.string_dict(),
+    "_setuptools_whl": attr.label(
+        allow_single_file = True,
+        default = Label("@pypi_setuptools//file"),
+    ),
+}
+
+pyz_binary = rule(
+    _pyz_binary_impl,
+    attrs = _pyz_binary_attrs,
     executable = True,
 )
 
+# runs srcs with pytest in the zip's process: see pyz_test(native_pytest=True)
+_pyz_pytest = rule(
+    _pyz_binary_impl,
+    attrs = _pyz_binary_attrs,
+    executable = True,
+    test = True,
+)
+
 def _pyz_script_test_impl(ctx):
     # run the pyz_binary with all our dependencies, with the srcs on the command line
     test_file_paths = []
@@ -254,12 +553,36 @@ _pyz_script_test = rule(
 
 def pyz_test(name, srcs=[], deps=[], wheels=[], data=[], force_all_unzip=False,
     flaky=None, licenses=[], local=None, timeout=None, shard_count=None, size=None,
-    interpreter_path="", tags=[], args=[]):
+    interpreter_path="", tags=[], args=[], native_pytest=False):
     '''Macro that outputs a pyz_binary with all the test code and executes it with a shell script
-    to pass the correct arguments.'''
+    to pass the correct arguments. With native_pytest, the test is one binary that packs srcs and
+    runs them with pytest in its own process.'''
 
     # Label ensures this is resolved correctly if used as an external workspace
     pytest_label = Label("//rules_python_zip:pytest")
+    if native_pytest:
+        _pyz_pytest(
+            name = name,
+            srcs = srcs,
+            deps = deps + [str(pytest_label)],
+            data = data,
+            wheels = wheels,
+            pytest = True,
+            interpreter_path = interpreter_path,
+            force_all_unzip = force_all_unzip,
+            testonly = True,
+            licenses = licenses,
+
+            flaky = flaky,
+            local = local,
+            shard_count = shard_count,
+            size = size,
+            timeout = timeout,
+            tags = tags,
+            args = args,
+        )
+        return
+
     compiled_deps_name = "%s__deps" % name
     pyz_binary(
         name = compiled_deps_name,
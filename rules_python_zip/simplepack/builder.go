@@ -0,0 +1,160 @@
+package simplepack
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Receive messages and progress while a zip is built. Nil functions are not called.
+type Hooks struct {
+	// Called with each warning, e.g. an import that cannot be resolved
+	Warning func(message string)
+	// Called with other messages, e.g. how many files tree shaking dropped
+	Log func(message string)
+	// Called after each source or wheel entry is written, with the number written so far and
+	// the number to write
+	Progress func(written int, total int)
+}
+
+func (h *Hooks) warnf(format string, args ...interface{}) {
+	if h != nil && h.Warning != nil {
+		h.Warning(fmt.Sprintf(format, args...))
+	}
+}
+
+func (h *Hooks) logf(format string, args ...interface{}) {
+	if h != nil && h.Log != nil {
+		h.Log(fmt.Sprintf(format, args...))
+	}
+}
+
+func (h *Hooks) progress(written int, total int) {
+	if h != nil && h.Progress != nil {
+		h.Progress(written, total)
+	}
+}
+
+// Which files are extracted before the entry point runs, in addition to native code and the
+// files pytest collects.
+type UnzipPolicy struct {
+	// Paths in the zip, or wheels, to extract
+	Paths []string
+	// Extract everything
+	All bool
+	// One of "", "warn", "error" or "unzip": what to do with code that is probably not zip safe
+	ZipSafetyCheck string
+}
+
+// Builds a zip from sources and wheels. Options without a setter are set on Manifest().
+type Builder struct {
+	manifest Manifest
+	hooks    Hooks
+}
+
+func NewBuilder() *Builder {
+	return &Builder{manifest: Manifest{EntryPoints: map[string]string{}, DefaultEnv: map[string]string{}}}
+}
+
+// Returns the manifest the builder packs.
+func (b *Builder) Manifest() *Manifest {
+	return &b.manifest
+}
+
+// Packs src, a file or a directory, at dst in the zip.
+func (b *Builder) AddSource(src string, dst string) {
+	b.manifest.Sources = append(b.manifest.Sources, ManifestSource{Src: src, Dst: filepath.ToSlash(dst)})
+}
+
+// Packs the wheel at wheelPath.
+func (b *Builder) AddWheel(wheelPath string) {
+	b.manifest.Wheels = append(b.manifest.Wheels, wheelPath)
+}
+
+// Runs entryPoint, a module or "module:function", when the zip runs.
+func (b *Builder) SetEntryPoint(entryPoint string) {
+	b.manifest.EntryPoint = entryPoint
+}
+
+// Sets the interpreter for the #! line, e.g. "/usr/bin/env python3".
+func (b *Builder) SetInterpreterPath(interpreterPath string) {
+	b.manifest.InterpreterPath = interpreterPath
+}
+
+func (b *Builder) SetUnzipPolicy(policy UnzipPolicy) {
+	b.manifest.ForceUnzip = policy.Paths
+	b.manifest.ForceAllUnzip = policy.All
+	b.manifest.ZipSafetyCheck = policy.ZipSafetyCheck
+}
+
+func (b *Builder) SetHooks(hooks Hooks) {
+	b.hooks = hooks
+}
+
+// Returns a copy of the manifest for one build, which changes it.
+func (b *Builder) buildManifest() *Manifest {
+	m := b.manifest
+	return &m
+}
+
+// Writes the zip, or another output format, to outputPath. Returns an *Error if it cannot be
+// built.
+func (b *Builder) WriteFile(outputPath string) error {
+	return Pack(b.buildManifest(), outputPath, &b.hooks)
+}
+
+// Writes the zip, or a tar output format, to w. Returns an *Error if it cannot be built.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	m := b.buildManifest()
+	if m.OutputFormat == outputDir {
+		return 0, invalidManifestf("output_format %s cannot be written to an io.Writer", outputDir)
+	}
+	counter := &countingWriter{w: w}
+	if !m.Layer && !isUnpackedFormat(m.OutputFormat) {
+		// checks the signing options like Pack
+		signingKey, err := loadSigningKey(m)
+		if err != nil {
+			return 0, invalidManifest(err)
+		}
+		if signingKey == nil {
+			err = writeZip(m, counter, sbomName(m, ""), nil, &b.hooks)
+			return counter.n, err
+		}
+	}
+
+	// layers, signed zips and tarballs are written to a file first
+	tempDir, err := ioutil.TempDir("", "simplepack")
+	if err != nil {
+		return 0, ioFailed(err)
+	}
+	defer os.RemoveAll(tempDir)
+	// the bill of materials names it like a zip written to w: see sbomName
+	outputPath := filepath.Join(tempDir, "pyz")
+	err = Pack(m, outputPath, &b.hooks)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Open(outputPath)
+	if err != nil {
+		return 0, ioFailed(err)
+	}
+	defer f.Close()
+	_, err = io.Copy(counter, f)
+	if err != nil {
+		return counter.n, ioFailed(err)
+	}
+	return counter.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,154 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	srcPath := filepath.Join(tempDir, "cli.py")
+	err = ioutil.WriteFile(srcPath, []byte("import missing_module\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wheelPath := filepath.Join(tempDir, "lib-1.0-py3-none-any.whl")
+	writeTestWheel(t, wheelPath, map[string]string{
+		"lib/__init__.py":            "",
+		"lib/data.txt":               "data",
+		"lib-1.0.dist-info/METADATA": "Name: lib\nVersion: 1.0\n",
+	})
+
+	b := NewBuilder()
+	b.AddSource(srcPath, "app/cli.py")
+	b.AddWheel(wheelPath)
+	b.SetEntryPoint("app.cli:main")
+	b.SetInterpreterPath("/usr/bin/env python3")
+	b.SetUnzipPolicy(UnzipPolicy{Paths: []string{"lib/data.txt"}})
+	b.Manifest().ImportCheck = checkWarn
+	warnings := []string{}
+	progress := []int{}
+	b.SetHooks(Hooks{
+		Warning:  func(message string) { warnings = append(warnings, message) },
+		Progress: func(written int, total int) { progress = append(progress, written, total) },
+	})
+	out := &bytes.Buffer{}
+	n, err := b.WriteTo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(out.Len()) || !bytes.HasPrefix(out.Bytes(), []byte("#!/usr/bin/env python3\n")) {
+		t.Errorf("WriteTo()=%d; wrote %d bytes: %#v...", n, out.Len(), out.String()[:30])
+	}
+	reader, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]*zip.File{}
+	for _, f := range reader.File {
+		names[f.Name] = f
+	}
+	for _, name := range []string{"__main__.py", "app/cli.py", "app/__init__.py", "lib/data.txt"} {
+		if names[name] == nil {
+			t.Errorf("%s is not in the zip", name)
+		}
+	}
+	data, err := readZipFile(names[zipInfoPath])
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &packageInfo{}
+	err = json.Unmarshal(data, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info.UnzipPaths, []string{"lib/data.txt"}) {
+		t.Errorf("unzip_paths=%#v; expected the unzip policy's path", info.UnzipPaths)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "missing_module") {
+		t.Errorf("warnings=%#v; expected missing_module", warnings)
+	}
+	// one source and three wheel files
+	expectedProgress := []int{1, 4, 2, 4, 3, 4, 4, 4}
+	if !reflect.DeepEqual(progress, expectedProgress) {
+		t.Errorf("progress=%#v; expected %#v", progress, expectedProgress)
+	}
+
+	// each build starts from the builder's manifest
+	outputPath := filepath.Join(tempDir, "out.pyz")
+	err = b.WriteFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Error("WriteFile() must write the same zip as WriteTo()")
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	srcPath := filepath.Join(tempDir, "cli.py")
+	err = ioutil.WriteFile(srcPath, []byte("import missing_module\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		configure func(b *Builder)
+		kind      ErrorKind
+	}{
+		{func(b *Builder) { b.SetEntryPoint("not a module") }, InvalidManifest},
+		{func(b *Builder) { b.AddSource(srcPath, "__main__.py") }, InvalidManifest},
+		{func(b *Builder) { b.Manifest().OutputFormat = outputDir }, InvalidManifest},
+		{func(b *Builder) {
+			b.AddSource(srcPath, "cli.py")
+			b.Manifest().ImportCheck = checkError
+		}, CheckFailed},
+		{func(b *Builder) { b.AddSource(filepath.Join(tempDir, "missing.py"), "cli.py") },
+			InvalidManifest},
+		// the zip cannot be checked without a key
+		{func(b *Builder) {
+			b.AddSource(srcPath, "cli.py")
+			b.Manifest().SignatureCheck = signatureCheckError
+		}, InvalidManifest},
+		{func(b *Builder) {
+			b.AddSource(srcPath, "cli.py")
+			b.Manifest().SigningKey = filepath.Join(tempDir, "missing.pem")
+		}, InvalidManifest},
+		// the script to run cannot be a directory
+		{func(b *Builder) { b.AddSource(tempDir, "app") }, InvalidManifest},
+		{func(b *Builder) {
+			b.AddSource(srcPath, "cli.py")
+			b.AddWheel(filepath.Join(tempDir, "missing-1.0-py3-none-any.whl"))
+		}, IOFailed},
+	}
+	for i, test := range tests {
+		b := NewBuilder()
+		test.configure(b)
+		_, err := b.WriteTo(ioutil.Discard)
+		var packErr *Error
+		if !errors.As(err, &packErr) || packErr.Kind != test.kind {
+			t.Errorf("%d: WriteTo() error=%#v; expected %s", i, err, test.kind)
+		}
+	}
+}
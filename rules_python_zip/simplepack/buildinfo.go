@@ -0,0 +1,72 @@
+package simplepack
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type distributionInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Wheel   string `json:"wheel"`
+}
+
+// Describes how the zip was built. Stored in _zip_info_.json and returned by
+// pyz_runtime.build_info() and --pyz-info.
+type buildInfo struct {
+	Target        string             `json:"target"`
+	Stamp         map[string]string  `json:"stamp"`
+	Distributions []distributionInfo `json:"distributions"`
+}
+
+// Parses a Bazel workspace status file: lines of "KEY value".
+func parseStatusFile(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) == 1 {
+			values[parts[0]] = ""
+		} else {
+			values[parts[0]] = parts[1]
+		}
+	}
+	return values, scanner.Err()
+}
+
+// Returns the build info for m, which packs wheels. Explicit Stamp values override values from
+// StampFiles, and later files override earlier files.
+func newBuildInfo(m *Manifest, wheels []*wheelContents) (*buildInfo, error) {
+	info := &buildInfo{m.Target, map[string]string{}, []distributionInfo{}}
+	for _, stampPath := range m.StampFiles {
+		f, err := os.Open(stampPath)
+		if err != nil {
+			return nil, err
+		}
+		values, err := parseStatusFile(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			info.Stamp[key] = value
+		}
+	}
+	for key, value := range m.Stamp {
+		info.Stamp[key] = value
+	}
+
+	for _, wheel := range wheels {
+		name, version := wheelNameVersion(wheel.Path)
+		info.Distributions = append(info.Distributions,
+			distributionInfo{name, version, filepath.Base(wheel.Path)})
+	}
+	return info, nil
+}
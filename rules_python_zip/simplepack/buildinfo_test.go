@@ -0,0 +1,76 @@
+package simplepack
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusFile(t *testing.T) {
+	values, err := parseStatusFile(strings.NewReader(
+		"BUILD_SCM_REVISION abc123\r\nBUILD_HOST build host\n\nEMPTY\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"BUILD_SCM_REVISION": "abc123",
+		"BUILD_HOST":         "build host",
+		"EMPTY":              "",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("parseStatusFile()=%#v; expected %#v", values, expected)
+	}
+}
+
+func TestNewBuildInfo(t *testing.T) {
+	statusFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(statusFile.Name())
+	_, err = statusFile.WriteString("BUILD_TIMESTAMP 123\nOVERRIDDEN file\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusFile.Close()
+
+	wheels := []*wheelContents{{Path: "external/pypi_six/file/six-1.11.0-py2.py3-none-any.whl"}}
+	m := &Manifest{
+		Target:     "//pkg:bin",
+		Stamp:      map[string]string{"OVERRIDDEN": "explicit"},
+		StampFiles: []string{statusFile.Name()},
+	}
+	info, err := newBuildInfo(m, wheels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &buildInfo{
+		"//pkg:bin",
+		map[string]string{"BUILD_TIMESTAMP": "123", "OVERRIDDEN": "explicit"},
+		[]distributionInfo{{"six", "1.11.0", "six-1.11.0-py2.py3-none-any.whl"}},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("newBuildInfo()=%#v; expected %#v", info, expected)
+	}
+
+	m.StampFiles = []string{statusFile.Name() + ".does_not_exist"}
+	_, err = newBuildInfo(m, wheels)
+	if err == nil {
+		t.Error("expected error for missing stamp file")
+	}
+}
+
+func TestIsReservedPath(t *testing.T) {
+	for _, path := range []string{"__main__.py", zipInfoPath, "pyz_runtime/info.py"} {
+		if !isReservedPath(path) {
+			t.Errorf("isReservedPath(%#v) should be true", path)
+		}
+	}
+	for _, path := range []string{"pkg/__main__.py", "pyz_runtime_other/x.py"} {
+		if isReservedPath(path) {
+			t.Errorf("isReservedPath(%#v) should be false", path)
+		}
+	}
+}
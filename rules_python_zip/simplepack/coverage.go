@@ -0,0 +1,84 @@
+package simplepack
+
+import (
+	"sort"
+	"strings"
+)
+
+// Lists the first-party sources for coverage tools. Read by pyz_runtime.coverage.
+const coverageManifestPath = "_coverage_.json"
+
+// A first-party source in the zip.
+type coverageSource struct {
+	Dst string `json:"dst"`
+	// Workspace-relative path
+	Src string `json:"src"`
+	// One of the test rule's srcs, which is not reported
+	IsTest bool `json:"is_test"`
+	// Dsts of the first-party modules this source imports
+	Imports []string `json:"imports"`
+}
+
+type coverageManifest struct {
+	Sources []*coverageSource `json:"sources"`
+}
+
+// Collects the first-party sources and their imports as they are packed.
+type coverageCollector struct {
+	// Dsts of the tests
+	tests   map[string]bool
+	sources []*coverageSource
+	// Dst to imported absolute module names
+	imports map[string][]string
+}
+
+func newCoverageCollector(tests []string) *coverageCollector {
+	c := &coverageCollector{map[string]bool{}, nil, map[string][]string{}}
+	for _, test := range tests {
+		c.tests[test] = true
+	}
+	return c
+}
+
+func (c *coverageCollector) AddSource(dst string, src string) {
+	c.sources = append(c.sources,
+		&coverageSource{dst, workspaceRelativePath(src), c.tests[dst], []string{}})
+}
+
+func (c *coverageCollector) Scan(filePath string, data []byte) {
+	modules := []string{}
+	for _, pyImport := range parsePythonImports(data) {
+		module := absoluteModule(filePath, pyImport.Module)
+		if module == "" {
+			continue
+		}
+		modules = append(modules, module)
+		// "from a import b" may import the submodule a.b
+		for _, name := range pyImport.Names {
+			modules = append(modules, module+"."+name)
+		}
+	}
+	c.imports[filePath] = modules
+}
+
+// Returns the manifest, with imports resolved to the sources that provide them.
+func (c *coverageCollector) Manifest() *coverageManifest {
+	moduleDsts := map[string]string{}
+	for _, source := range c.sources {
+		if strings.HasSuffix(source.Dst, ".py") {
+			moduleDsts[pyFileModule(source.Dst)] = source.Dst
+		}
+	}
+	for _, source := range c.sources {
+		imported := map[string]bool{}
+		for _, module := range c.imports[source.Dst] {
+			dst, ok := moduleDsts[module]
+			if ok && dst != source.Dst && !imported[dst] {
+				imported[dst] = true
+				source.Imports = append(source.Imports, dst)
+			}
+		}
+		sort.Strings(source.Imports)
+	}
+	return &coverageManifest{c.sources}
+}
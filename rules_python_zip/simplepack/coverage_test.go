@@ -0,0 +1,39 @@
+package simplepack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoverageCollector(t *testing.T) {
+	// the test rule's srcs are tests, whatever their names
+	c := newCoverageCollector([]string{"pkg/a_test.py", "pkg/checks.py"})
+	c.AddSource("main.py", "main.py")
+	c.AddSource("pkg/__init__.py", "pkg/__init__.py")
+	c.AddSource("pkg/a.py", "bazel-out/k8-fastbuild/bin/pkg/a.py")
+	c.AddSource("pkg/b.py", "pkg/b.py")
+	c.AddSource("pkg/a_test.py", "pkg/a_test.py")
+	c.AddSource("pkg/checks.py", "pkg/checks.py")
+	c.AddSource("pkg/test_util.py", "pkg/test_util.py")
+	c.AddSource("pkg/data.txt", "pkg/data.txt")
+	c.Scan("main.py", []byte("import os\nimport pkg.a\nfrom pkg import b\n"))
+	c.Scan("pkg/a.py", []byte("from . import b\nfrom .b import x\nimport pkg.a\n"))
+	c.Scan("pkg/a_test.py", []byte("import pkg.a\n"))
+
+	expected := []*coverageSource{
+		{"main.py", "main.py", false, []string{"pkg/__init__.py", "pkg/a.py", "pkg/b.py"}},
+		{"pkg/__init__.py", "pkg/__init__.py", false, []string{}},
+		{"pkg/a.py", "pkg/a.py", false, []string{"pkg/__init__.py", "pkg/b.py"}},
+		{"pkg/b.py", "pkg/b.py", false, []string{}},
+		{"pkg/a_test.py", "pkg/a_test.py", true, []string{"pkg/a.py"}},
+		{"pkg/checks.py", "pkg/checks.py", true, []string{}},
+		{"pkg/test_util.py", "pkg/test_util.py", false, []string{}},
+		{"pkg/data.txt", "pkg/data.txt", false, []string{}},
+	}
+	manifest := c.Manifest()
+	if !reflect.DeepEqual(manifest.Sources, expected) {
+		for i, source := range manifest.Sources {
+			t.Errorf("Sources[%d]=%#v", i, source)
+		}
+	}
+}
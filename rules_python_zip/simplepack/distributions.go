@@ -0,0 +1,139 @@
+package simplepack
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The project a wheel installs, from its dist-info.
+type wheelDistribution struct {
+	// Normalized project name
+	Project string
+	Version string
+	Wheel   *wheelContents
+}
+
+// Returns the distribution a wheel installs, or nil if it has no dist-info directory. The name
+// and version come from METADATA, or from the directory name if it has none.
+func readWheelDistribution(wheel *wheelContents) (*wheelDistribution, error) {
+	dir, metadata, err := readWheelMetadata(wheel)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		for _, f := range wheel.Files {
+			dir = distInfoDir(f.Name)
+			if dir != "" {
+				break
+			}
+		}
+		if dir == "" {
+			return nil, nil
+		}
+	}
+	nameVersion := strings.SplitN(strings.TrimSuffix(dir, ".dist-info"), "-", 2)
+	project := distInfoProjectName(dir)
+	if name := metadata.Get("Name"); name != "" {
+		project = normalizeProjectName(name)
+	}
+	version := metadata.Get("Version")
+	if version == "" && len(nameVersion) == 2 {
+		version = nameVersion[1]
+	}
+	return &wheelDistribution{project, version, wheel}, nil
+}
+
+// Returns true if preferred, a wheel path or file name, names wheel.
+func matchesPreferredWheel(wheel *wheelContents, preferred string) bool {
+	return wheel.Path == preferred || filepath.Base(wheel.Path) == preferred
+}
+
+// Returns the wheels to pack: one for each project. A wheel listed more than once is packed
+// once. Returns an error if two wheels install the same project, unless one of them matches
+// preferredWheels, which then replaces the others.
+func selectDistributions(
+	wheels []*wheelContents, preferredWheels []string,
+) ([]*wheelContents, error) {
+	isPreferred := func(wheel *wheelContents) bool {
+		for _, preferred := range preferredWheels {
+			if matchesPreferredWheel(wheel, preferred) {
+				return true
+			}
+		}
+		return false
+	}
+
+	seenPaths := map[string]bool{}
+	byProject := map[string][]*wheelDistribution{}
+	projects := []string{}
+	for _, wheel := range wheels {
+		if seenPaths[wheel.Path] {
+			continue
+		}
+		seenPaths[wheel.Path] = true
+		distribution, err := readWheelDistribution(wheel)
+		if err != nil {
+			return nil, err
+		}
+		if distribution == nil {
+			continue
+		}
+		if len(byProject[distribution.Project]) == 0 {
+			projects = append(projects, distribution.Project)
+		}
+		byProject[distribution.Project] = append(byProject[distribution.Project], distribution)
+	}
+
+	dropped := map[*wheelContents]bool{}
+	for _, project := range projects {
+		candidates := byProject[project]
+		if len(candidates) == 1 {
+			continue
+		}
+		var chosen *wheelDistribution
+		for _, candidate := range candidates {
+			if !isPreferred(candidate.Wheel) {
+				continue
+			}
+			if chosen != nil {
+				return nil, fmt.Errorf("preferred_wheels lists more than one wheel of %s: %s and %s",
+					project, filepath.Base(chosen.Wheel.Path), filepath.Base(candidate.Wheel.Path))
+			}
+			chosen = candidate
+		}
+		if chosen == nil {
+			return nil, fmt.Errorf(
+				"%s is packed more than once: %s (version %s) and %s (version %s); "+
+					"list the one to pack in preferred_wheels",
+				project, candidates[0].Wheel.Path, candidates[0].Version,
+				candidates[1].Wheel.Path, candidates[1].Version)
+		}
+		for _, candidate := range candidates {
+			if candidate != chosen {
+				dropped[candidate.Wheel] = true
+			}
+		}
+	}
+
+	for _, preferred := range preferredWheels {
+		found := false
+		for _, wheel := range wheels {
+			found = found || matchesPreferredWheel(wheel, preferred)
+		}
+		if !found {
+			return nil, fmt.Errorf("preferred_wheels: %#v is not one of the wheels", preferred)
+		}
+	}
+
+	selected := []*wheelContents{}
+	seenPaths = map[string]bool{}
+	for _, wheel := range wheels {
+		if seenPaths[wheel.Path] || dropped[wheel] {
+			continue
+		}
+		seenPaths[wheel.Path] = true
+		selected = append(selected, wheel)
+	}
+	return selected, nil
+}
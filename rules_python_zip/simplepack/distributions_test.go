@@ -0,0 +1,70 @@
+package simplepack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelectDistributions(t *testing.T) {
+	six10 := testWheelContents(t, "a/six-1.10.0-py2.py3-none-any.whl", map[string]string{
+		"six.py":                        "",
+		"six-1.10.0.dist-info/METADATA": "Name: six\nVersion: 1.10.0\n",
+	})
+	six11 := testWheelContents(t, "b/six-1.11.0-py2.py3-none-any.whl", map[string]string{
+		"six.py":                        "",
+		"six-1.11.0.dist-info/METADATA": "Name: six\nVersion: 1.11.0\n",
+	})
+	// no METADATA: the name comes from the directory
+	zope := testWheelContents(t, "c/zope.interface-4.5.0-py3-none-any.whl", map[string]string{
+		"zope.interface-4.5.0.dist-info/RECORD": "",
+	})
+	zopeOther := testWheelContents(t, "d/Zope_Interface-5.0-py3-none-any.whl", map[string]string{
+		"Zope_Interface-5.0.dist-info/METADATA": "Name: Zope_Interface\nVersion: 5.0\n",
+	})
+	noDistInfo := testWheelContents(t, "e/bare-1.0-py3-none-any.whl", map[string]string{
+		"bare.py": "",
+	})
+
+	selected, err := selectDistributions(
+		[]*wheelContents{six10, zope, noDistInfo, zope}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 3 || selected[0] != six10 || selected[1] != zope || selected[2] != noDistInfo {
+		t.Errorf("selectDistributions=%#v; expected each wheel once", selected)
+	}
+
+	_, err = selectDistributions([]*wheelContents{six10, six11}, nil)
+	if err == nil || !strings.Contains(err.Error(), "a/six-1.10.0-py2.py3-none-any.whl (version 1.10.0)") ||
+		!strings.Contains(err.Error(), "b/six-1.11.0-py2.py3-none-any.whl (version 1.11.0)") {
+		t.Errorf("selectDistributions(six 1.10, six 1.11) error=%v; expected both wheels", err)
+	}
+	_, err = selectDistributions([]*wheelContents{zope, zopeOther}, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "zope-interface is packed more than once") {
+		t.Errorf("selectDistributions(zope.interface, Zope_Interface) error=%v", err)
+	}
+
+	selected, err = selectDistributions(
+		[]*wheelContents{six10, zope, six11}, []string{"six-1.11.0-py2.py3-none-any.whl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 || selected[0] != zope || selected[1] != six11 {
+		t.Errorf("selectDistributions(preferred six 1.11)=%#v", selected)
+	}
+	selected, err = selectDistributions([]*wheelContents{six10, six11}, []string{six10.Path})
+	if err != nil || len(selected) != 1 || selected[0] != six10 {
+		t.Errorf("selectDistributions(preferred %s)=%#v, %v", six10.Path, selected, err)
+	}
+
+	invalid := [][]string{
+		{"six-1.12.0-py2.py3-none-any.whl"},
+		{six10.Path, six11.Path},
+	}
+	for _, preferred := range invalid {
+		_, err = selectDistributions([]*wheelContents{six10, six11}, preferred)
+		if err == nil {
+			t.Errorf("selectDistributions(preferred %#v)=nil error; expected error", preferred)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package simplepack
+
+import "fmt"
+
+// What kind of problem an Error reports.
+type ErrorKind int
+
+const (
+	// The manifest is invalid, e.g. it sets options that cannot be combined
+	InvalidManifest ErrorKind = iota + 1
+	// A build-time check set to "error" found problems, e.g. ImportCheck
+	CheckFailed
+	// Reading an input or writing an output failed
+	IOFailed
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case InvalidManifest:
+		return "invalid manifest"
+	case CheckFailed:
+		return "check failed"
+	case IOFailed:
+		return "I/O failed"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// Returned by Pack and Builder when the zip cannot be built.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func invalidManifest(err error) error {
+	return &Error{InvalidManifest, err}
+}
+
+func invalidManifestf(format string, args ...interface{}) error {
+	return invalidManifest(fmt.Errorf(format, args...))
+}
+
+func checkFailedf(format string, args ...interface{}) error {
+	return &Error{CheckFailed, fmt.Errorf(format, args...)}
+}
+
+func ioFailed(err error) error {
+	return &Error{IOFailed, err}
+}
@@ -0,0 +1,336 @@
+package simplepack
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var importStatementRe = regexp.MustCompile(`^import\s+(.+)$`)
+var fromImportStatementRe = regexp.MustCompile(`^from\s+(\.*)\s*([\w.]*)\s+import\b`)
+var moduleNameRe = regexp.MustCompile(`^[A-Za-z_][\w.]*$`)
+
+// Matches the header of a compound statement followed by a statement on the same line, e.g.
+// "if x: import y". The first group is the keyword, the second is the rest of the line.
+var inlineCompoundRe = regexp.MustCompile(
+	`^(try|else|finally|if|elif|except|with|for|while)\b[^:]*:\s*(.*)$`)
+
+// A single Python logical line: physical lines joined by brackets or backslashes, with
+// comments removed and string literals replaced by "".
+type logicalLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// Splits Python source into logical lines. This is not a complete tokenizer, but it is enough
+// to find import statements without being confused by strings, comments or continuations.
+func pythonLogicalLines(data []byte) []logicalLine {
+	lines := []logicalLine{}
+	current := &bytes.Buffer{}
+	lineNumber := 1
+	startLine := 1
+	indent := 0
+	atLineStart := true
+	depth := 0
+	flush := func() {
+		text := strings.TrimSpace(current.String())
+		if text != "" {
+			lines = append(lines, logicalLine{startLine, indent, text})
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if atLineStart {
+			indent = 0
+			for ; i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\f'); i++ {
+				if data[i] == '\t' {
+					indent += 8 - indent%8
+				} else if data[i] == ' ' {
+					indent++
+				}
+			}
+			startLine = lineNumber
+			atLineStart = false
+			i--
+			continue
+		}
+
+		switch c {
+		case '#':
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case '\\':
+			next := i + 1
+			if next < len(data) && data[next] == '\r' {
+				next++
+			}
+			if next < len(data) && data[next] == '\n' {
+				i = next
+				lineNumber++
+				current.WriteByte(' ')
+			} else {
+				current.WriteByte(c)
+			}
+		case '\'', '"':
+			triple := i+2 < len(data) && data[i+1] == c && data[i+2] == c
+			if triple {
+				i += 2
+			}
+			for i+1 < len(data) {
+				i++
+				if data[i] == '\\' {
+					if i+1 < len(data) && data[i+1] == '\n' {
+						lineNumber++
+					}
+					i++
+				} else if data[i] == '\n' {
+					if !triple {
+						// unterminated string: let the newline end the logical line
+						i--
+						break
+					}
+					lineNumber++
+				} else if data[i] == c {
+					if !triple {
+						break
+					}
+					if i+2 < len(data) && data[i+1] == c && data[i+2] == c {
+						i += 2
+						break
+					}
+				}
+			}
+			current.WriteString(`""`)
+		case '(', '[', '{':
+			depth++
+			current.WriteByte(c)
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+			current.WriteByte(c)
+		case '\n':
+			lineNumber++
+			if depth == 0 {
+				flush()
+				atLineStart = true
+			} else {
+				current.WriteByte(' ')
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return lines
+}
+
+// An import statement found in Python source.
+type pyImport struct {
+	Line int
+	// Dotted module name; relative imports start with one dot per level
+	Module string
+	// True if the import is inside a try statement, which usually means it is optional
+	Optional bool
+	// Names imported by "from x import a, b", which may be submodules
+	Names []string
+}
+
+// Returns the modules imported by Python source. For "from x import y" only x is returned,
+// since y can be either a submodule or a name defined in x.
+func parsePythonImports(data []byte) []pyImport {
+	imports := []pyImport{}
+	tryIndents := []int{}
+	for _, line := range pythonLogicalLines(data) {
+		for len(tryIndents) > 0 && line.indent <= tryIndents[len(tryIndents)-1] {
+			if line.indent == tryIndents[len(tryIndents)-1] {
+				keyword := strings.SplitN(strings.TrimLeft(line.text, " "), ":", 2)[0]
+				keyword = strings.Fields(keyword + " ")[0]
+				if keyword == "except" || keyword == "else" || keyword == "finally" {
+					break
+				}
+			}
+			tryIndents = tryIndents[:len(tryIndents)-1]
+		}
+
+		for _, statement := range strings.Split(line.text, ";") {
+			statement = strings.TrimSpace(statement)
+			for {
+				match := inlineCompoundRe.FindStringSubmatch(statement)
+				if match == nil {
+					break
+				}
+				if match[1] == "try" && (len(tryIndents) == 0 || tryIndents[len(tryIndents)-1] != line.indent) {
+					tryIndents = append(tryIndents, line.indent)
+				}
+				statement = match[2]
+			}
+			optional := len(tryIndents) > 0
+
+			if match := importStatementRe.FindStringSubmatch(statement); match != nil {
+				for _, part := range strings.Split(match[1], ",") {
+					fields := strings.Fields(part)
+					if len(fields) > 0 && moduleNameRe.MatchString(fields[0]) {
+						imports = append(imports, pyImport{line.number, fields[0], optional, nil})
+					}
+				}
+			} else if match := fromImportStatementRe.FindStringSubmatch(statement); match != nil {
+				module := match[1] + match[2]
+				if module == "" {
+					continue
+				}
+				names := []string{}
+				importedNames := strings.Trim(statement[len(match[0]):], " ()")
+				for _, part := range strings.Split(importedNames, ",") {
+					fields := strings.Fields(part)
+					if len(fields) > 0 {
+						names = append(names, fields[0])
+					}
+				}
+				imports = append(imports, pyImport{line.number, module, optional, names})
+			}
+		}
+	}
+	return imports
+}
+
+type unresolvedImport struct {
+	Path   string
+	Line   int
+	Module string
+}
+
+func (u unresolvedImport) String() string {
+	return fmt.Sprintf("%s:%d: cannot resolve import %s", u.Path, u.Line, u.Module)
+}
+
+// Checks that the imports in Python source files can be satisfied by the files in the zip or
+// the standard library.
+type importChecker struct {
+	pythonVersion string
+	allow         []string
+	imports       map[string][]pyImport
+}
+
+func newImportChecker(pythonVersion string, allow []string) *importChecker {
+	return &importChecker{pythonVersion, allow, map[string][]pyImport{}}
+}
+
+func (c *importChecker) Scan(filePath string, data []byte) {
+	if !strings.HasSuffix(filePath, ".py") {
+		return
+	}
+	c.imports[filePath] = parsePythonImports(data)
+}
+
+func (c *importChecker) isAllowed(module string) bool {
+	for _, allowed := range c.allow {
+		if module == allowed || strings.HasPrefix(module, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the dotted names of all modules and packages provided by paths.
+func moduleNames(paths []string) map[string]bool {
+	modules := map[string]bool{}
+	for _, filePath := range paths {
+		var module string
+		if isPyFile(filePath) {
+			module = filePath[:strings.LastIndex(filePath, ".")]
+			module = strings.TrimSuffix(module, "/__init__")
+		} else if strings.HasSuffix(filePath, ".so") || strings.HasSuffix(filePath, ".pyd") {
+			// extension modules can have names like _speedups.cpython-36m-x86_64-linux-gnu.so
+			dir, file := "", filePath
+			if slash := strings.LastIndex(filePath, "/"); slash >= 0 {
+				dir, file = filePath[:slash+1], filePath[slash+1:]
+			}
+			module = dir + strings.SplitN(file, ".", 2)[0]
+		} else {
+			continue
+		}
+		module = strings.Replace(module, "/", ".", -1)
+		for module != "" && !modules[module] {
+			modules[module] = true
+			lastDot := strings.LastIndex(module, ".")
+			if lastDot < 0 {
+				break
+			}
+			module = module[:lastDot]
+		}
+	}
+	return modules
+}
+
+// Returns the package containing the module stored at filePath, e.g. "a.b" for "a/b/c.py" and
+// "a/b/__init__.py".
+func containingPackage(filePath string) string {
+	dir := filePath[:strings.LastIndex(filePath, "/")+1]
+	return strings.Replace(strings.TrimSuffix(dir, "/"), "/", ".", -1)
+}
+
+// Returns the absolute module name for an import in filePath, or "" if a relative import goes
+// beyond the top-level package.
+func absoluteModule(filePath string, module string) string {
+	name := strings.TrimLeft(module, ".")
+	level := len(module) - len(name)
+	if level == 0 {
+		return module
+	}
+	packageParts := []string{}
+	if pkg := containingPackage(filePath); pkg != "" {
+		packageParts = strings.Split(pkg, ".")
+	}
+	if level-1 >= len(packageParts) {
+		return ""
+	}
+	parts := packageParts[:len(packageParts)-(level-1)]
+	if name != "" {
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Returns the imports that cannot be resolved, given the paths stored in the zip.
+func (c *importChecker) Unresolved(paths []string) []unresolvedImport {
+	modules := moduleNames(paths)
+	stdlib := stdlibModules(c.pythonVersion)
+	isPython2 := strings.HasPrefix(c.pythonVersion, "2")
+
+	out := []unresolvedImport{}
+	for filePath, imports := range c.imports {
+		for _, imp := range imports {
+			if imp.Optional {
+				continue
+			}
+			module := absoluteModule(filePath, imp.Module)
+			if module == "" {
+				out = append(out, unresolvedImport{filePath, imp.Line, imp.Module})
+				continue
+			}
+			if modules[module] || stdlib[strings.SplitN(module, ".", 2)[0]] || c.isAllowed(module) {
+				continue
+			}
+			// Python 2 implicit relative imports
+			pkg := containingPackage(filePath)
+			if isPython2 && module == imp.Module && pkg != "" && modules[pkg+"."+module] {
+				continue
+			}
+			out = append(out, unresolvedImport{filePath, imp.Line, module})
+		}
+	}
+	sort.Slice(out, func(i int, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Line < out[j].Line
+	})
+	return out
+}
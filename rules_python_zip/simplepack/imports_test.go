@@ -0,0 +1,133 @@
+package simplepack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPythonLogicalLines(t *testing.T) {
+	source := `"""docstring
+import notreal
+"""
+import a, b.c as d  # comment with import e
+x = ("import f",
+     'g')
+if x: \
+    import h
+`
+	lines := pythonLogicalLines([]byte(source))
+	expected := []logicalLine{
+		{1, 0, `""`},
+		{4, 0, "import a, b.c as d"},
+		{5, 0, `x = ("",      "")`},
+		{7, 0, "if x:      import h"},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("pythonLogicalLines()=%#v; expected %#v", lines, expected)
+	}
+}
+
+func TestParsePythonImports(t *testing.T) {
+	source := `from __future__ import absolute_import
+import os, json as j
+from . import sibling
+from ..parent.mod import (
+    name,
+    other,
+)
+try:
+    import simplejson
+except ImportError:
+    import json as simplejson
+else:
+    import yaml
+import required
+def f():
+    try: import inline_optional
+    finally: pass
+    import inner_required; import another
+`
+	imports := parsePythonImports([]byte(source))
+	expected := []pyImport{
+		{1, "__future__", false, []string{"absolute_import"}},
+		{2, "os", false, nil},
+		{2, "json", false, nil},
+		{3, ".", false, []string{"sibling"}},
+		{4, "..parent.mod", false, []string{"name", "other"}},
+		{9, "simplejson", true, nil},
+		{11, "json", true, nil},
+		{13, "yaml", true, nil},
+		{14, "required", false, nil},
+		{16, "inline_optional", true, nil},
+		{18, "inner_required", false, nil},
+		{18, "another", false, nil},
+	}
+	if !reflect.DeepEqual(imports, expected) {
+		t.Errorf("parsePythonImports()=%#v; expected %#v", imports, expected)
+	}
+}
+
+func TestAbsoluteModule(t *testing.T) {
+	tests := []struct {
+		path     string
+		module   string
+		expected string
+	}{
+		{"a/b/c.py", "x.y", "x.y"},
+		{"a/b/c.py", ".", "a.b"},
+		{"a/b/c.py", ".d", "a.b.d"},
+		{"a/b/c.py", "..d", "a.d"},
+		{"a/b/__init__.py", "..", "a"},
+		{"a/b/c.py", "...d", ""},
+		{"a/b/c.py", "...", ""},
+		{"top.py", ".x", ""},
+	}
+	for _, test := range tests {
+		out := absoluteModule(test.path, test.module)
+		if out != test.expected {
+			t.Errorf("absoluteModule(%#v, %#v)=%#v; expected %#v",
+				test.path, test.module, out, test.expected)
+		}
+	}
+}
+
+func TestImportCheckerUnresolved(t *testing.T) {
+	checker := newImportChecker("3.6", []string{"optional_dep"})
+	checker.Scan("main.py", []byte(`import os
+import pkg.sub
+import pkg.missing
+from pkg import anything
+import native_ext
+import optional_dep.sub
+import urllib2
+`))
+	checker.Scan("pkg/sub.py", []byte("from . import helper\nfrom .gone import x\nimport sibling\n"))
+	paths := []string{
+		"main.py",
+		"native_ext.cpython-36m-x86_64-linux-gnu.so",
+		"pkg/__init__.py",
+		"pkg/sibling.py",
+		"pkg/sub.py",
+	}
+	expected := []unresolvedImport{
+		{"main.py", 3, "pkg.missing"},
+		{"main.py", 7, "urllib2"},
+		{"pkg/sub.py", 2, "pkg.gone"},
+		{"pkg/sub.py", 3, "sibling"},
+	}
+	out := checker.Unresolved(paths)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Unresolved()=%#v; expected %#v", out, expected)
+	}
+
+	// Python 2: stdlib differs and implicit relative imports work
+	checker.pythonVersion = "2.7"
+	expected = []unresolvedImport{
+		{"main.py", 3, "pkg.missing"},
+		{"pkg/sub.py", 2, "pkg.gone"},
+	}
+	out = checker.Unresolved(paths)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Unresolved()=%#v; expected %#v", out, expected)
+	}
+}
@@ -0,0 +1,150 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Lists the wheels in a layer zip. Written as the last entry, so it is not copied.
+const layerManifestPath = "_layer_.json"
+
+// A wheel in a layer: its entries follow the previous wheel's, in the same order as a full
+// build writes them.
+type layerWheel struct {
+	Path  string
+	Files int
+}
+
+type layerManifest struct {
+	Wheels []layerWheel
+}
+
+// Writes the entries of wheels to a layer zip at outputPath. A build that lists the layer in
+// Manifest.Layers copies the entries instead of reading the wheels, which produces exactly
+// the same output.
+func writeLayer(wheels []string, outputPath string) error {
+	outFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	zipWriter := newCachedPathsZipWriter(outFile)
+	defer zipWriter.Close()
+
+	workers := packWorkers()
+	noLayers, err := openLayers(nil)
+	if err != nil {
+		return err
+	}
+	openedWheels, err := openWheels(wheels, noLayers, workers)
+	if err != nil {
+		return err
+	}
+	defer closeWheels(openedWheels)
+	jobs := []*packJob{}
+	layer := &layerManifest{[]layerWheel{}}
+	for _, wheel := range openedWheels {
+		for _, wheelF := range wheel.Files {
+			jobs = append(jobs, &packJob{name: wheel.OutputPath(wheelF), wheelF: wheelF})
+		}
+		layer.Wheels = append(layer.Wheels, layerWheel{wheel.Path, len(wheel.Files)})
+	}
+	pipeline := newPackPipeline(jobs, workers)
+	defer pipeline.Close()
+	for range jobs {
+		entry, err := pipeline.Next()
+		if err != nil {
+			return err
+		}
+		err = zipWriter.Copy(entry.file)
+		if err != nil {
+			return err
+		}
+	}
+	err = closeWheels(openedWheels)
+	if err != nil {
+		return err
+	}
+
+	writer, err := zipWriter.CreateWithMethod(nil, layerManifestPath, zipMethod)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(writer).Encode(layer)
+	if err != nil {
+		return err
+	}
+	err = zipWriter.Close()
+	if err != nil {
+		return err
+	}
+	return outFile.Close()
+}
+
+// Prebuilt wheel entries from layer zips.
+type wheelLayers struct {
+	readers []*zip.ReadCloser
+	// Wheel path to its entries
+	wheels map[string][]*zip.File
+}
+
+func openLayers(paths []string) (*wheelLayers, error) {
+	layers := &wheelLayers{nil, map[string][]*zip.File{}}
+	for _, path := range paths {
+		reader, err := zip.OpenReader(path)
+		if err != nil {
+			layers.Close()
+			return nil, fmt.Errorf("Error loading layer %s: %s", path, err)
+		}
+		layers.readers = append(layers.readers, reader)
+
+		last := len(reader.File) - 1
+		if last < 0 || reader.File[last].Name != layerManifestPath {
+			layers.Close()
+			return nil, fmt.Errorf("%s is not a layer: missing %s", path, layerManifestPath)
+		}
+		manifestReader, err := reader.File[last].Open()
+		if err != nil {
+			layers.Close()
+			return nil, err
+		}
+		layer := &layerManifest{}
+		err = json.NewDecoder(manifestReader).Decode(layer)
+		manifestReader.Close()
+		if err != nil {
+			layers.Close()
+			return nil, fmt.Errorf("layer %s: %s", path, err)
+		}
+
+		offset := 0
+		for _, wheel := range layer.Wheels {
+			if offset+wheel.Files > last {
+				layers.Close()
+				return nil, fmt.Errorf("layer %s: too few entries for %s", path, wheel.Path)
+			}
+			layers.wheels[wheel.Path] = reader.File[offset : offset+wheel.Files]
+			offset += wheel.Files
+		}
+	}
+	return layers, nil
+}
+
+// Returns the entries for wheelPath, or false if no layer contains it.
+func (l *wheelLayers) Files(wheelPath string) ([]*zip.File, bool) {
+	files, ok := l.wheels[wheelPath]
+	return files, ok
+}
+
+func (l *wheelLayers) Close() error {
+	var firstErr error
+	for _, reader := range l.readers {
+		err := reader.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.readers = nil
+	return firstErr
+}
@@ -0,0 +1,111 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLayerCopyIsIdentical(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	wheelPath := filepath.Join(tempDir, "lib-2.0-py3-none-any.whl")
+	writeTestWheel(t, wheelPath, map[string]string{
+		"lib/__init__.py":                   "import os\n",
+		"lib-2.0.data/purelib/extra/mod.py": "X = 1\n",
+		"lib-2.0.dist-info/METADATA":        "Name: lib\n",
+	})
+	layerPath := filepath.Join(tempDir, "layer.zip")
+	err = writeLayer([]string{wheelPath}, layerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a full build reads the wheel
+	full := &bytes.Buffer{}
+	zw := newCachedPathsZipWriter(full)
+	reader, err := zip.OpenReader(wheelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for _, wheelF := range reader.File {
+		writeSerial(t, zw, wheelF, handlePurelibPlatlib(wheelF.Name))
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a layered build copies the layer entries
+	layers, err := openLayers([]string{layerPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layers.Close()
+	layerFiles, ok := layers.Files(wheelPath)
+	if !ok || len(layerFiles) != 3 {
+		t.Fatalf("layers.Files(%s)=%d files, %v; expected 3 files", wheelPath, len(layerFiles), ok)
+	}
+	if _, ok := layers.Files("other.whl"); ok {
+		t.Error("layers.Files(other.whl) should not be found")
+	}
+	layered := &bytes.Buffer{}
+	zw = newCachedPathsZipWriter(layered)
+	scanners := []sourceScanner{&recordingScanner{map[string]string{}}}
+	jobs := []*packJob{}
+	for _, layerF := range layerFiles {
+		jobs = append(jobs, &packJob{name: layerF.Name, layerF: layerF,
+			keepData: needsScan(layerF.Name, scanners)})
+	}
+	pipeline := newPackPipeline(jobs, 2)
+	for _, job := range jobs {
+		entry, err := pipeline.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = zw.Copy(entry.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanSource(job.name, entry.data, scanners)
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(full.Bytes(), layered.Bytes()) {
+		t.Error("copying layer entries must produce the same zip as reading the wheel")
+	}
+	expectedPaths := []string{"extra/mod.py", "lib-2.0.dist-info/METADATA", "lib/__init__.py"}
+	if !reflect.DeepEqual(zw.Paths(), expectedPaths) {
+		t.Errorf("Paths()=%#v; expected %#v", zw.Paths(), expectedPaths)
+	}
+	expectedScanned := map[string]string{"extra/mod.py": "X = 1\n", "lib/__init__.py": "import os\n"}
+	scanned := scanners[0].(*recordingScanner).scanned
+	if !reflect.DeepEqual(scanned, expectedScanned) {
+		t.Errorf("scanned=%#v; expected %#v", scanned, expectedScanned)
+	}
+}
+
+func TestOpenLayersNotLayer(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	wheelPath := filepath.Join(tempDir, "lib-2.0-py3-none-any.whl")
+	writeTestWheel(t, wheelPath, map[string]string{"lib/__init__.py": ""})
+	_, err = openLayers([]string{wheelPath})
+	if err == nil {
+		t.Error("openLayers(wheel) should fail: it is not a layer")
+	}
+}
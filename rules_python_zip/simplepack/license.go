@@ -0,0 +1,364 @@
+package simplepack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Paths of the bill of materials and the license notices of the wheels in the zip
+const sbomPath = "_sbom_.spdx.json"
+const noticesPath = "THIRD_PARTY_NOTICES"
+
+// Value of SPDX fields that are not known
+const spdxNoAssertion = "NOASSERTION"
+
+// SPDX license identifiers that distributions commonly declare
+var knownSPDXLicenses = map[string]bool{
+	"0BSD": true, "Apache-2.0": true, "BSD-2-Clause": true, "BSD-3-Clause": true,
+	"CC0-1.0": true, "GPL-2.0-only": true, "GPL-2.0-or-later": true, "GPL-3.0-only": true,
+	"GPL-3.0-or-later": true, "HPND": true, "ISC": true, "LGPL-2.1-only": true,
+	"LGPL-2.1-or-later": true, "LGPL-3.0-only": true, "LGPL-3.0-or-later": true, "MIT": true,
+	"MPL-2.0": true, "PSF-2.0": true, "Python-2.0": true, "Unlicense": true, "Zlib": true,
+}
+
+// Normalized License values that name one license. Ambiguous values, like "BSD" or "GPL", are
+// not listed, nor is "public domain", which is not a license SPDX can identify.
+var licenseNames = map[string]string{
+	"mit":                                "MIT",
+	"mit license":                        "MIT",
+	"the mit license":                    "MIT",
+	"apache 2":                           "Apache-2.0",
+	"apache 2.0":                         "Apache-2.0",
+	"apache license 2.0":                 "Apache-2.0",
+	"apache license version 2.0":         "Apache-2.0",
+	"apache software license 2.0":        "Apache-2.0",
+	"bsd 2 clause":                       "BSD-2-Clause",
+	"simplified bsd":                     "BSD-2-Clause",
+	"bsd 3 clause":                       "BSD-3-Clause",
+	"3 clause bsd":                       "BSD-3-Clause",
+	"new bsd":                            "BSD-3-Clause",
+	"new bsd license":                    "BSD-3-Clause",
+	"modified bsd":                       "BSD-3-Clause",
+	"isc":                                "ISC",
+	"isc license":                        "ISC",
+	"mpl 2.0":                            "MPL-2.0",
+	"mozilla public license 2.0":         "MPL-2.0",
+	"psf":                                "PSF-2.0",
+	"psf license":                        "PSF-2.0",
+	"python software foundation license": "PSF-2.0",
+	"unlicense":                          "Unlicense",
+}
+
+// License classifiers that name one license. Classifiers without a version, like
+// "License :: OSI Approved :: Apache Software License", are not listed. See
+// https://pypi.org/classifiers/
+var licenseClassifiers = map[string]string{
+	"License :: OSI Approved :: MIT License":                                        "MIT",
+	"License :: OSI Approved :: ISC License (ISCL)":                                 "ISC",
+	"License :: OSI Approved :: Mozilla Public License 2.0 (MPL 2.0)":               "MPL-2.0",
+	"License :: OSI Approved :: Python Software Foundation License":                 "PSF-2.0",
+	"License :: OSI Approved :: The Unlicense (Unlicense)":                          "Unlicense",
+	"License :: OSI Approved :: zlib/libpng License":                                "Zlib",
+	"License :: CC0 1.0 Universal (CC0 1.0) Public Domain Dedication":               "CC0-1.0",
+	"License :: OSI Approved :: Historical Permission Notice and Disclaimer (HPND)": "HPND",
+}
+
+var licenseNameSeparatorRe = regexp.MustCompile(`[^a-z0-9.]+`)
+
+// Dist-info files that are license texts even if METADATA does not list them
+var licenseFileRe = regexp.MustCompile(`(?i)^(licen[cs]e|copying|notice)`)
+
+// Returns true if expression is an SPDX license expression of known licenses.
+func isSPDXExpression(expression string) bool {
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expression))
+	if len(fields) == 0 {
+		return false
+	}
+	for _, field := range fields {
+		if !knownSPDXLicenses[field] && field != "AND" && field != "OR" && field != "WITH" {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the SPDX license expression declared by a distribution's metadata, or "" if it is
+// missing or unknown. License-Expression is preferred, then License, then the classifiers.
+func declaredLicense(metadata distMetadata) string {
+	if expression := metadata.Get("License-Expression"); expression != "" {
+		return expression
+	}
+	license := strings.TrimSpace(metadata.Get("License"))
+	if isSPDXExpression(license) {
+		return license
+	}
+	normalized := strings.TrimSpace(
+		licenseNameSeparatorRe.ReplaceAllLiteralString(strings.ToLower(license), " "))
+	normalized = strings.TrimSuffix(normalized, " license")
+	if id := licenseNames[normalized]; id != "" {
+		return id
+	}
+	if id := licenseNames[normalized+" license"]; id != "" {
+		return id
+	}
+	ids := []string{}
+	for _, classifier := range metadata["classifier"] {
+		id := licenseClassifiers[strings.TrimSpace(classifier)]
+		if id != "" && !containsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	// distributions that list several licenses usually let users choose
+	return strings.Join(ids, " OR ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// The license information of a packed wheel.
+type wheelLicense struct {
+	Wheel   string
+	Name    string
+	Version string
+	// SPDX expression, or "" if it is missing or unknown
+	Declared string
+	// The License value from METADATA, which may be the full license text
+	LicenseText string
+	// Dist-info path to contents of the license files
+	FileNames []string
+	Files     map[string][]byte
+	// Why the license needs review, or ""
+	Problem string
+}
+
+// Reads the license metadata and license files from the dist-info directory of wheel.
+func readWheelLicense(wheel *wheelContents) (*wheelLicense, error) {
+	dir, metadata, err := readWheelMetadata(wheel)
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		name, version := wheelNameVersion(wheel.Path)
+		return &wheelLicense{Wheel: filepath.Base(wheel.Path), Name: name, Version: version,
+			Files: map[string][]byte{}, Problem: "no dist-info METADATA"}, nil
+	}
+	license := &wheelLicense{
+		Wheel:       filepath.Base(wheel.Path),
+		Name:        metadata.Get("Name"),
+		Version:     metadata.Get("Version"),
+		Declared:    declaredLicense(metadata),
+		LicenseText: metadata.Get("License"),
+		Files:       map[string][]byte{},
+	}
+	// the setuptools default
+	if license.LicenseText == "UNKNOWN" {
+		license.LicenseText = ""
+	}
+	if license.Declared == "" {
+		described := strings.SplitN(license.LicenseText, "\n", 2)[0]
+		for _, classifier := range metadata["classifier"] {
+			if described == "" && strings.HasPrefix(classifier, "License ::") {
+				described = classifier
+			}
+		}
+		if described == "" {
+			license.Problem = "no license information"
+		} else {
+			license.Problem = fmt.Sprintf("unknown license: %#v", described)
+		}
+	}
+
+	// PEP 639 puts License-File paths under licenses/; older tools put them in dist-info
+	wanted := map[string]bool{}
+	for _, licenseFile := range metadata["license-file"] {
+		wanted[dir+"/licenses/"+licenseFile] = true
+		wanted[dir+"/"+licenseFile] = true
+	}
+	for _, f := range wheel.Files {
+		if distInfoDir(f.Name) != dir || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if !wanted[f.Name] && !(path.Dir(f.Name) == dir && licenseFileRe.MatchString(path.Base(f.Name))) {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		license.FileNames = append(license.FileNames, f.Name)
+		license.Files[f.Name] = data
+	}
+	sort.Strings(license.FileNames)
+	return license, nil
+}
+
+// Returns the combined license notices of the distributions.
+func thirdPartyNotices(licenses []*wheelLicense) []byte {
+	separator := strings.Repeat("=", 80) + "\n"
+	out := &bytes.Buffer{}
+	for _, license := range licenses {
+		out.WriteString(separator)
+		fmt.Fprintf(out, "%s %s\n", license.Name, license.Version)
+		declared := license.Declared
+		if declared == "" {
+			declared = "unknown"
+		}
+		fmt.Fprintf(out, "License: %s\n", declared)
+		out.WriteString(separator)
+		out.WriteString("\n")
+		if len(license.FileNames) == 0 {
+			if license.LicenseText != "" {
+				out.WriteString(license.LicenseText + "\n\n")
+			}
+			fmt.Fprintf(out, "No license file was found in %s.\n\n", license.Wheel)
+		}
+		for _, fileName := range license.FileNames {
+			out.Write(bytes.TrimRight(license.Files[fileName], "\n"))
+			out.WriteString("\n\n")
+		}
+	}
+	return out.Bytes()
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	PackageFileName  string            `json:"packageFileName"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+var spdxIDInvalidRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// Returns an SPDX 2.3 document that lists the distributions packed in the zip named name.
+// It only depends on its inputs, so the output is reproducible.
+func newSPDXDocument(name string, licenses []*wheelLicense) *spdxDocument {
+	doc := &spdxDocument{
+		SPDXVersion:  "SPDX-2.3",
+		DataLicense:  "CC0-1.0",
+		SPDXID:       "SPDXRef-DOCUMENT",
+		Name:         name,
+		CreationInfo: spdxCreationInfo{portableMtime.Format("2006-01-02T15:04:05Z"), []string{"Tool: simplepack"}},
+		Packages:     []spdxPackage{},
+	}
+	for _, license := range licenses {
+		declared := license.Declared
+		if declared == "" {
+			declared = spdxNoAssertion
+		}
+		id := "SPDXRef-Package-" + spdxIDInvalidRe.ReplaceAllLiteralString(
+			normalizeProjectName(license.Name)+"-"+license.Version, "-")
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             license.Name,
+			SPDXID:           id,
+			VersionInfo:      license.Version,
+			PackageFileName:  license.Wheel,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  declared,
+			ExternalRefs: []spdxExternalRef{{"PACKAGE-MANAGER", "purl",
+				"pkg:pypi/" + normalizeProjectName(license.Name) + "@" + license.Version}},
+			Comment: license.Problem,
+		})
+		doc.Relationships = append(doc.Relationships,
+			spdxRelationship{doc.SPDXID, "DESCRIBES", id})
+	}
+
+	// unique for each set of packages, without a random ID
+	packagesJSON, err := json.Marshal(doc.Packages)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(packagesJSON)
+	doc.DocumentNamespace = "https://spdx.org/spdxdocs/" +
+		spdxIDInvalidRe.ReplaceAllLiteralString(name, "-") + "-" + hex.EncodeToString(sum[:16])
+	return doc
+}
+
+// Reads the licenses of wheels, sorted by normalized project name.
+func readWheelLicenses(wheels []*wheelContents) ([]*wheelLicense, error) {
+	licenses := []*wheelLicense{}
+	for _, wheel := range wheels {
+		license, err := readWheelLicense(wheel)
+		if err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, license)
+	}
+	sort.SliceStable(licenses, func(i, j int) bool {
+		return normalizeProjectName(licenses[i].Name) < normalizeProjectName(licenses[j].Name)
+	})
+	return licenses, nil
+}
+
+// Checks the license settings in m.
+func validateLicenseOptions(m *Manifest) error {
+	switch m.LicenseCheck {
+	case checkOff, checkWarn, checkError:
+	default:
+		return fmt.Errorf("invalid license_check: %#v", m.LicenseCheck)
+	}
+	if !m.SBOM && (m.SBOMFile != "" || m.NoticesFile != "") {
+		return fmt.Errorf("sbom_file and notices_file require sbom")
+	}
+	return nil
+}
+
+// Returns the name of the SPDX document for the zip: the Bazel target, or the output file.
+// outputPath is "" for a zip written to an io.Writer.
+func sbomName(m *Manifest, outputPath string) string {
+	if m.Target != "" {
+		return m.Target
+	}
+	if outputPath == "" {
+		return "pyz"
+	}
+	return filepath.Base(outputPath)
+}
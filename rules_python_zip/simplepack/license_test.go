@@ -0,0 +1,102 @@
+package simplepack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeclaredLicense(t *testing.T) {
+	tests := []struct {
+		metadata distMetadata
+		expected string
+	}{
+		{distMetadata{"license-expression": {"MIT OR Apache-2.0"}, "license": {"BSD"}},
+			"MIT OR Apache-2.0"},
+		{distMetadata{"license": {"BSD-3-Clause"}}, "BSD-3-Clause"},
+		{distMetadata{"license": {"Apache License, Version 2.0"}}, "Apache-2.0"},
+		{distMetadata{"license": {"MIT License"}}, "MIT"},
+		{distMetadata{"license": {"new BSD License"}}, "BSD-3-Clause"},
+		{distMetadata{"license": {"BSD"}, "classifier": {
+			"License :: OSI Approved :: MIT License",
+			"Programming Language :: Python",
+			"License :: OSI Approved :: Apache Software License",
+		}}, "MIT"},
+		{distMetadata{"classifier": {
+			"License :: OSI Approved :: ISC License (ISCL)",
+			"License :: OSI Approved :: zlib/libpng License",
+		}}, "ISC OR Zlib"},
+		{distMetadata{"classifier": {"License :: OSI Approved :: Apache Software License"}}, ""},
+		{distMetadata{"license": {"Public Domain"}}, ""},
+		{distMetadata{"license": {"BSD"}}, ""},
+		{distMetadata{"license": {"Copyright (c) Example\nAll rights reserved"}}, ""},
+		{distMetadata{}, ""},
+	}
+	for _, test := range tests {
+		output := declaredLicense(test.metadata)
+		if output != test.expected {
+			t.Errorf("declaredLicense(%#v)=%#v; expected %#v", test.metadata, output, test.expected)
+		}
+	}
+}
+
+func TestReadWheelLicenses(t *testing.T) {
+	wheels := []*wheelContents{
+		testWheelContents(t, "wheels/Zed_Lib-2.0-py3-none-any.whl", map[string]string{
+			"zed_lib/__init__.py": "",
+			"Zed_Lib-2.0.dist-info/METADATA": "Name: Zed_Lib\nVersion: 2.0\n" +
+				"License-Expression: MIT\nLicense-File: LICENSE\n",
+			"Zed_Lib-2.0.dist-info/licenses/LICENSE": "zed license\n",
+		}),
+		testWheelContents(t, "wheels/alpha-1.0-py2.py3-none-any.whl", map[string]string{
+			"alpha.py":                       "",
+			"alpha-1.0.dist-info/METADATA":   "Name: alpha\nVersion: 1.0\nLicense: UNKNOWN\n",
+			"alpha-1.0.dist-info/COPYING":    "alpha copying\n",
+			"alpha-1.0.dist-info/RECORD":     "",
+			"alpha-1.0.dist-info/top_level":  "alpha\n",
+			"alpha-1.0.dist-info/sub/NOTICE": "not in the dist-info root\n",
+		}),
+		testWheelContents(t, "wheels/bare-0.1-py3-none-any.whl", map[string]string{"bare.py": ""}),
+	}
+	licenses, err := readWheelLicenses(wheels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, license := range licenses {
+		names = append(names, license.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"alpha", "bare", "Zed_Lib"}) {
+		t.Fatalf("names=%#v", names)
+	}
+	if licenses[0].Problem != "no license information" ||
+		!reflect.DeepEqual(licenses[0].FileNames, []string{"alpha-1.0.dist-info/COPYING"}) {
+		t.Errorf("alpha=%#v", licenses[0])
+	}
+	if licenses[1].Problem != "no dist-info METADATA" || licenses[1].Version != "0.1" {
+		t.Errorf("bare=%#v", licenses[1])
+	}
+	if licenses[2].Declared != "MIT" || licenses[2].Problem != "" ||
+		!reflect.DeepEqual(licenses[2].FileNames, []string{"Zed_Lib-2.0.dist-info/licenses/LICENSE"}) {
+		t.Errorf("Zed_Lib=%#v", licenses[2])
+	}
+
+	notices := string(thirdPartyNotices(licenses))
+	for _, expected := range []string{"alpha 1.0\nLicense: unknown\n", "alpha copying\n",
+		"No license file was found in bare-0.1-py3-none-any.whl.", "Zed_Lib 2.0\nLicense: MIT\n",
+		"zed license\n"} {
+		if !strings.Contains(notices, expected) {
+			t.Errorf("notices do not contain %#v:\n%s", expected, notices)
+		}
+	}
+
+	doc := newSPDXDocument("//pkg:bin", licenses)
+	if doc.Packages[2].SPDXID != "SPDXRef-Package-zed-lib-2.0" ||
+		doc.Packages[2].ExternalRefs[0].ReferenceLocator != "pkg:pypi/zed-lib@2.0" ||
+		doc.Packages[0].LicenseDeclared != spdxNoAssertion {
+		t.Errorf("unexpected packages: %#v", doc.Packages)
+	}
+	if !reflect.DeepEqual(newSPDXDocument("//pkg:bin", licenses), doc) {
+		t.Error("newSPDXDocument must be deterministic")
+	}
+}
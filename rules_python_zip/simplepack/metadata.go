@@ -0,0 +1,138 @@
+package simplepack
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var projectNameSeparatorRe = regexp.MustCompile(`[-_.]+`)
+
+// Returns the normalized form of a project name. See
+// https://www.python.org/dev/peps/pep-0503/#normalized-names
+func normalizeProjectName(name string) string {
+	return strings.ToLower(projectNameSeparatorRe.ReplaceAllLiteralString(name, "-"))
+}
+
+// Returns the *.dist-info directory for a path in a wheel, or "" if it is not metadata.
+func distInfoDir(path string) string {
+	dir := strings.SplitN(path, "/", 2)[0]
+	if dir != path && strings.HasSuffix(dir, ".dist-info") {
+		return dir
+	}
+	return ""
+}
+
+// Returns the normalized project name for a dist-info directory like "zope.interface-4.5.0.dist-info".
+func distInfoProjectName(dir string) string {
+	nameVersion := strings.TrimSuffix(dir, ".dist-info")
+	return normalizeProjectName(strings.SplitN(nameVersion, "-", 2)[0])
+}
+
+// Returns true if path is the entry_points.txt of a distribution in a wheel.
+func isEntryPointsFile(path string) bool {
+	dir := distInfoDir(path)
+	return dir != "" && path == dir+"/entry_points.txt"
+}
+
+// Parses the [console_scripts] section of an entry_points.txt file and returns a map of script
+// name to "module:function". Scripts with names or entry points that cannot be run from the zip
+// are skipped. See https://packaging.python.org/specifications/entry-points/
+func parseConsoleScripts(r io.Reader) (map[string]string, error) {
+	scripts := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != "console_scripts" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		// remove extras: "module:function [extra1,extra2]"
+		entryPoint := strings.TrimSpace(strings.SplitN(parts[1], "[", 2)[0])
+		entryPoint = strings.Replace(entryPoint, " ", "", -1)
+		if name == "" || strings.ContainsAny(name, "/\\") || name[0] == '.' || name[0] == '-' {
+			continue
+		}
+		if validateModuleEntryPoint(entryPoint) != nil {
+			continue
+		}
+		scripts[name] = entryPoint
+	}
+	return scripts, scanner.Err()
+}
+
+// The headers of a distribution's METADATA file, by lower case name. Headers like Classifier
+// can have several values. See https://packaging.python.org/specifications/core-metadata/
+type distMetadata map[string][]string
+
+// Returns the first value of the header name, or "".
+func (m distMetadata) Get(name string) string {
+	values := m[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Parses the headers of a METADATA file, which end at the first empty line. Continuation lines
+// start with whitespace, and the "|" that bdist_wheel adds to them is removed.
+func parseDistMetadata(r io.Reader) (distMetadata, error) {
+	metadata := distMetadata{}
+	lastName := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if lastName != "" {
+				values := metadata[lastName]
+				continuation := strings.TrimPrefix(strings.TrimSpace(line), "|")
+				values[len(values)-1] += "\n" + continuation
+			}
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			lastName = ""
+			continue
+		}
+		lastName = strings.ToLower(strings.TrimSpace(parts[0]))
+		metadata[lastName] = append(metadata[lastName], strings.TrimSpace(parts[1]))
+	}
+	return metadata, scanner.Err()
+}
+
+// Returns the dist-info directory of a wheel and its parsed METADATA, or nil if the wheel has
+// no METADATA.
+func readWheelMetadata(wheel *wheelContents) (string, distMetadata, error) {
+	for _, f := range wheel.Files {
+		dir := distInfoDir(f.Name)
+		if dir == "" || f.Name != dir+"/METADATA" {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return "", nil, err
+		}
+		metadata, err := parseDistMetadata(bytes.NewReader(data))
+		return dir, metadata, err
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,101 @@
+package simplepack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeProjectName(t *testing.T) {
+	tests := map[string]string{
+		"requests":          "requests",
+		"Zope.Interface":    "zope-interface",
+		"google_cloud-core": "google-cloud-core",
+		"a__-.b":            "a-b",
+	}
+	for name, expected := range tests {
+		out := normalizeProjectName(name)
+		if out != expected {
+			t.Errorf("normalizeProjectName(%#v)=%#v; expected %#v", name, out, expected)
+		}
+	}
+}
+
+func TestDistInfoDir(t *testing.T) {
+	tests := map[string]string{
+		"attrs-18.1.0.dist-info/METADATA":   "attrs-18.1.0.dist-info",
+		"attrs/__init__.py":                 "",
+		"weird.dist-info":                   "",
+		"pkg/nested-1.0.dist-info/METADATA": "",
+	}
+	for path, expected := range tests {
+		out := distInfoDir(path)
+		if out != expected {
+			t.Errorf("distInfoDir(%#v)=%#v; expected %#v", path, out, expected)
+		}
+	}
+
+	project := distInfoProjectName("zope.interface-4.5.0.dist-info")
+	if project != "zope-interface" {
+		t.Errorf("distInfoProjectName()=%#v", project)
+	}
+}
+
+func TestIsEntryPointsFile(t *testing.T) {
+	tests := map[string]bool{
+		"tool-1.0.dist-info/entry_points.txt":     true,
+		"tool-1.0.dist-info/METADATA":             false,
+		"tool/entry_points.txt":                   false,
+		"tool-1.0.dist-info/sub/entry_points.txt": false,
+	}
+	for path, expected := range tests {
+		if isEntryPointsFile(path) != expected {
+			t.Errorf("isEntryPointsFile(%#v) should be %v", path, expected)
+		}
+	}
+}
+
+func TestParseConsoleScripts(t *testing.T) {
+	input := `# comment
+[console_scripts]
+tool = tool.cli:main
+tool-extra = tool.cli : main_extra [extra1, extra2]
+../escape = tool.cli:main
+bad = tool.cli:
+; comment
+
+[gui_scripts]
+tool-gui = tool.gui:main
+`
+	scripts, err := parseConsoleScripts(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"tool": "tool.cli:main", "tool-extra": "tool.cli:main_extra"}
+	if !reflect.DeepEqual(scripts, expected) {
+		t.Errorf("parseConsoleScripts()=%#v; expected %#v", scripts, expected)
+	}
+}
+
+func TestParseDistMetadata(t *testing.T) {
+	input := "Metadata-Version: 2.1\r\nName: tool\nVersion: 1.0\n" +
+		"Classifier: License :: OSI Approved :: MIT License\n" +
+		"classifier: Programming Language :: Python\n" +
+		"License: Line one\n       |  indented\nbad line\n\nName: body\n"
+	metadata, err := parseDistMetadata(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Get("name") != "tool" || metadata.Get("Version") != "1.0" {
+		t.Errorf("Name=%#v Version=%#v", metadata.Get("name"), metadata.Get("Version"))
+	}
+	if len(metadata["classifier"]) != 2 {
+		t.Errorf("classifier=%#v; expected 2 values", metadata["classifier"])
+	}
+	if metadata.Get("License") != "Line one\n  indented" {
+		t.Errorf("License=%#v", metadata.Get("License"))
+	}
+	if metadata.Get("Missing") != "" {
+		t.Errorf("Missing=%#v; expected empty", metadata.Get("Missing"))
+	}
+}
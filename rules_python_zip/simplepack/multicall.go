@@ -0,0 +1,83 @@
+package simplepack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of entry points, as written to the generated __main__.py
+const (
+	entryPointKindModule = "module"
+	entryPointKindScript = "script"
+)
+
+// Returns true if entryPoint names a script in the zip instead of a module.
+func isScriptEntryPoint(entryPoint string) bool {
+	return strings.HasSuffix(entryPoint, ".py") || strings.Contains(entryPoint, "/")
+}
+
+// Returns an error if entryPoint is not "module" or "module:function", where function may be a
+// dotted attribute path.
+func validateModuleEntryPoint(entryPoint string) error {
+	parts := strings.SplitN(entryPoint, ":", 2)
+	for _, part := range parts {
+		if !moduleNameRe.MatchString(part) {
+			return fmt.Errorf("invalid entry point %#v: must be module or module:function",
+				entryPoint)
+		}
+	}
+	return nil
+}
+
+// Returns the module that must be imported to run a module entry point.
+func entryPointModule(entryPoint string) string {
+	return strings.SplitN(entryPoint, ":", 2)[0]
+}
+
+// Checks the command names and entry points of a multicall zip. Scripts must be in sources.
+func validateCommands(commands map[string]string, sources []ManifestSource) error {
+	sourceDsts := map[string]bool{}
+	for _, sourceMeta := range sources {
+		sourceDsts[sourceMeta.Dst] = true
+	}
+	for _, name := range sortedCommandNames(commands) {
+		if name == "" || strings.ContainsAny(name, "/\\\n") || strings.HasPrefix(name, "-") {
+			return fmt.Errorf("invalid command name %#v", name)
+		}
+		entryPoint := commands[name]
+		if isScriptEntryPoint(entryPoint) {
+			if !sourceDsts[entryPoint] {
+				return fmt.Errorf("command %s: script %#v is not in Sources", name, entryPoint)
+			}
+			continue
+		}
+		err := validateModuleEntryPoint(entryPoint)
+		if err != nil {
+			return fmt.Errorf("command %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func sortedCommandNames(commands map[string]string) []string {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns a Python dict literal mapping command names to (kind, entry point) pairs.
+func commandsLiteral(commands map[string]string) string {
+	pairs := map[string][2]string{}
+	for name, entryPoint := range commands {
+		kind := entryPointKindModule
+		if isScriptEntryPoint(entryPoint) {
+			kind = entryPointKindScript
+		}
+		pairs[name] = [2]string{kind, entryPoint}
+	}
+	return pythonLiteral(pairs)
+}
@@ -0,0 +1,62 @@
+package simplepack
+
+import "testing"
+
+func TestValidateModuleEntryPoint(t *testing.T) {
+	valid := []string{"pkg", "pkg.mod", "pkg.mod:main", "pkg:Class.run", "_private:_main"}
+	for _, entryPoint := range valid {
+		err := validateModuleEntryPoint(entryPoint)
+		if err != nil {
+			t.Errorf("validateModuleEntryPoint(%#v)=%s; expected nil", entryPoint, err)
+		}
+	}
+	invalid := []string{"", "pkg:", ":main", "pkg:main:x", "pkg main", "pkg'); x('", "1pkg"}
+	for _, entryPoint := range invalid {
+		err := validateModuleEntryPoint(entryPoint)
+		if err == nil {
+			t.Errorf("validateModuleEntryPoint(%#v)=nil; expected error", entryPoint)
+		}
+	}
+}
+
+func TestValidateCommands(t *testing.T) {
+	sources := []ManifestSource{{Src: "src/tools/a.py", Dst: "tools/a.py"}}
+	valid := map[string]string{"a": "tools/a.py", "b": "pkg.b", "c-tool": "pkg.c:main"}
+	err := validateCommands(valid, sources)
+	if err != nil {
+		t.Error(err)
+	}
+
+	invalid := []map[string]string{
+		{"": "pkg"},
+		{"a/b": "pkg"},
+		{"--help": "pkg"},
+		{"a": "tools/missing.py"},
+		{"a": "pkg:"},
+	}
+	for _, commands := range invalid {
+		err = validateCommands(commands, sources)
+		if err == nil {
+			t.Errorf("validateCommands(%#v)=nil; expected error", commands)
+		}
+	}
+}
+
+func TestCommandsLiteral(t *testing.T) {
+	output := commandsLiteral(map[string]string{
+		"z": "pkg.z:main", "a": "tools/a.py", "q": "x'y", "r": `a<b&"c\.py`})
+	expected := `{"a":["script","tools/a.py"],"q":["module","x'y"],` +
+		`"r":["script","a<b&\"c\\.py"],"z":["module","pkg.z:main"]}`
+	if output != expected {
+		t.Errorf("commandsLiteral()=%s; expected %s", output, expected)
+	}
+}
+
+func TestEntryPointModule(t *testing.T) {
+	for entryPoint, expected := range map[string]string{"a.b": "a.b", "a.b:main": "a.b"} {
+		output := entryPointModule(entryPoint)
+		if output != expected {
+			t.Errorf("entryPointModule(%#v)=%#v; expected %#v", entryPoint, output, expected)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package simplepack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Values for Manifest.OutputFormat
+const (
+	// Executable zip with a #! line
+	outputZip = ""
+	// Unpacked directory that runs with "python (dir)"
+	outputDir = "dir"
+	// Tarball of the unpacked directory under InstallPrefix
+	outputTar   = "tar"
+	outputTarGz = "tar.gz"
+	// Gzipped tar to use as an OCI image layer, and optionally OCIMetadata describing it
+	outputOCILayer = "oci_layer"
+)
+
+// Install prefix of an OCI image layer if the manifest does not set one
+const defaultOCIInstallPrefix = "/app"
+
+// Media type of layers written for outputOCILayer
+const ociLayerMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+// Modification time of every entry in a tarball, so the output does not depend on when the
+// inputs were written. The same as Bazel's pkg_tar.
+var portableMtime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Returns true if the format is not a zip, so __main__.py runs from a directory.
+func isUnpackedFormat(format string) bool {
+	return format != outputZip
+}
+
+// Checks the output format settings in m.
+func validateOutputFormat(m *Manifest) error {
+	switch m.OutputFormat {
+	case outputZip, outputDir:
+		if m.InstallPrefix != "" {
+			return fmt.Errorf("install_prefix requires output_format tar, tar.gz or oci_layer")
+		}
+	case outputTar, outputTarGz, outputOCILayer:
+	default:
+		return fmt.Errorf("invalid output_format: %#v", m.OutputFormat)
+	}
+	// zipimport and zipfile read a stored symlink as a file that contains the link target
+	if m.SourceSymlinks == symlinksStore && !isUnpackedFormat(m.OutputFormat) {
+		return fmt.Errorf("source_symlinks=store requires output_format dir, tar, tar.gz or oci_layer")
+	}
+	if m.OutputFormat != outputOCILayer && (m.OCIMetadata != "" || len(m.OCIEntrypoint) > 0) {
+		return fmt.Errorf("oci_metadata and oci_entrypoint require output_format oci_layer")
+	}
+	for _, part := range strings.Split(m.InstallPrefix, "/") {
+		if part == ".." {
+			return fmt.Errorf("invalid install_prefix: %#v", m.InstallPrefix)
+		}
+	}
+	return nil
+}
+
+// Returns the install prefix as an absolute path.
+func (m *Manifest) installPrefix() string {
+	prefix := m.InstallPrefix
+	if prefix == "" && m.OutputFormat == outputOCILayer {
+		prefix = defaultOCIInstallPrefix
+	}
+	return path.Clean("/" + prefix)
+}
+
+// Returns the command that runs the installed package: the interpreter and the prefix.
+func (m *Manifest) ociEntrypoint() []string {
+	if len(m.OCIEntrypoint) > 0 {
+		return m.OCIEntrypoint
+	}
+	return append(strings.Fields(m.InterpreterPath), m.installPrefix())
+}
+
+// Normalizes the permissions of an unpacked file: only the executable bit is kept.
+func unpackedMode(f *zip.File) os.FileMode {
+	if f.Mode()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// Writes the entries of the packed zip at zipPath to outputPath in m.OutputFormat.
+func writeOutputFormat(m *Manifest, zipPath string, outputPath string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if m.OutputFormat == outputDir {
+		return writeDir(reader.File, outputPath)
+	}
+	outFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// the digests identify an OCI layer: the compressed blob and the uncompressed diff_id
+	var w io.Writer = outFile
+	layerDigest := sha256.New()
+	diffID := sha256.New()
+	var gzipWriter *gzip.Writer
+	if m.OutputFormat != outputTar {
+		// a zero gzip header, so the output is deterministic
+		gzipWriter = gzip.NewWriter(io.MultiWriter(outFile, layerDigest))
+		w = io.MultiWriter(gzipWriter, diffID)
+	}
+	err = writeTar(reader.File, strings.TrimPrefix(m.installPrefix(), "/"), w)
+	if err != nil {
+		return err
+	}
+	if gzipWriter != nil {
+		err = gzipWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	stat, err := outFile.Stat()
+	if err != nil {
+		return err
+	}
+	err = outFile.Close()
+	if err != nil {
+		return err
+	}
+
+	if m.OCIMetadata != "" {
+		metadata := &ociMetadata{
+			ociDescriptor{ociLayerMediaType, digestString(layerDigest), stat.Size()},
+			digestString(diffID),
+			ociConfig{m.ociEntrypoint()},
+		}
+		return writeJSONFile(m.OCIMetadata, metadata)
+	}
+	return nil
+}
+
+func writeDir(files []*zip.File, outputPath string) error {
+	// replace anything left from a previous build
+	err := os.RemoveAll(outputPath)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(outputPath, 0755)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if isZipDir(f) {
+			continue
+		}
+		filePath := filepath.Join(outputPath, filepath.FromSlash(f.Name))
+		err = os.MkdirAll(filepath.Dir(filePath), 0755)
+		if err != nil {
+			return err
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			target, err := readZipFile(f)
+			if err != nil {
+				return err
+			}
+			err = os.Symlink(string(target), filePath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = writeZipFileTo(f, filePath, unpackedMode(f))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns true if f is a directory entry, which some wheels contain.
+func isZipDir(f *zip.File) bool {
+	return strings.HasSuffix(f.Name, "/")
+}
+
+func writeZipFileTo(f *zip.File, filePath string, mode os.FileMode) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Writes files to a tarball under prefix, which is relative. Parent directories are written
+// before the first file they contain.
+func writeTar(files []*zip.File, prefix string, w io.Writer) error {
+	tarWriter := tar.NewWriter(w)
+	writtenDirs := map[string]bool{".": true}
+	var writeDirs func(dir string) error
+	writeDirs = func(dir string) error {
+		if writtenDirs[dir] {
+			return nil
+		}
+		err := writeDirs(path.Dir(dir))
+		if err != nil {
+			return err
+		}
+		writtenDirs[dir] = true
+		return tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir + "/",
+			Mode:     0755,
+			ModTime:  portableMtime,
+		})
+	}
+
+	for _, f := range files {
+		if isZipDir(f) {
+			// written with the first file it contains
+			continue
+		}
+		name := path.Join(prefix, f.Name)
+		err := writeDirs(path.Dir(name))
+		if err != nil {
+			return err
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			target, err := readZipFile(f)
+			if err != nil {
+				return err
+			}
+			err = tarWriter.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeSymlink,
+				Name:     name,
+				Linkname: string(target),
+				Mode:     0777,
+				ModTime:  portableMtime,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     int64(unpackedMode(f)),
+			Size:     int64(f.UncompressedSize64),
+			ModTime:  portableMtime,
+		})
+		if err != nil {
+			return err
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// Describes an OCI image layer written for outputOCILayer, so image build tools can append it
+// to a base image.
+type ociMetadata struct {
+	Layer  ociDescriptor `json:"layer"`
+	DiffID string        `json:"diff_id"`
+	// Fields to set in the image config
+	Config ociConfig `json:"config"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociConfig struct {
+	Entrypoint []string
+}
+
+func digestString(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func writeJSONFile(filePath string, value interface{}) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(value)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
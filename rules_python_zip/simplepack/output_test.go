@@ -0,0 +1,124 @@
+package simplepack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestValidateOutputFormat(t *testing.T) {
+	valid := []*Manifest{
+		{},
+		{OutputFormat: outputDir},
+		{OutputFormat: outputTar, InstallPrefix: "/opt/app"},
+		{OutputFormat: outputTarGz, SourceSymlinks: symlinksStore},
+		{OutputFormat: outputOCILayer, OCIMetadata: "oci.json", OCIEntrypoint: []string{"python3"}},
+	}
+	for _, m := range valid {
+		err := validateOutputFormat(m)
+		if err != nil {
+			t.Errorf("validateOutputFormat(%#v)=%s; expected nil", m, err)
+		}
+	}
+	invalid := []*Manifest{
+		{OutputFormat: "zip64"},
+		{InstallPrefix: "/app"},
+		{OutputFormat: outputDir, InstallPrefix: "/app"},
+		{OutputFormat: outputTar, InstallPrefix: "../app"},
+		{OutputFormat: outputTar, OCIMetadata: "oci.json"},
+		{SourceSymlinks: symlinksStore},
+	}
+	for _, m := range invalid {
+		err := validateOutputFormat(m)
+		if err == nil {
+			t.Errorf("validateOutputFormat(%#v)=nil; expected error", m)
+		}
+	}
+}
+
+func TestOCIEntrypoint(t *testing.T) {
+	m := &Manifest{OutputFormat: outputOCILayer, InterpreterPath: "/usr/bin/env python3"}
+	expected := []string{"/usr/bin/env", "python3", "/app"}
+	if !reflect.DeepEqual(m.ociEntrypoint(), expected) {
+		t.Errorf("ociEntrypoint()=%#v; expected %#v", m.ociEntrypoint(), expected)
+	}
+	m.InstallPrefix = "srv/tool/"
+	expected = []string{"/usr/bin/env", "python3", "/srv/tool"}
+	if !reflect.DeepEqual(m.ociEntrypoint(), expected) {
+		t.Errorf("ociEntrypoint()=%#v; expected %#v", m.ociEntrypoint(), expected)
+	}
+	m.OCIEntrypoint = []string{"/srv/tool/run"}
+	if !reflect.DeepEqual(m.ociEntrypoint(), m.OCIEntrypoint) {
+		t.Errorf("ociEntrypoint()=%#v; expected %#v", m.ociEntrypoint(), m.OCIEntrypoint)
+	}
+}
+
+func TestWriteTar(t *testing.T) {
+	zipBuf := &bytes.Buffer{}
+	zw := zip.NewWriter(zipBuf)
+	for _, name := range []string{"__main__.py", "pkg/", "pkg/sub/a.py", "pkg/b.so"} {
+		header := &zip.FileHeader{Name: name}
+		if name == "pkg/b.so" {
+			header.SetMode(0775)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	err = writeTar(reader.File, "opt/app", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarReader := tar.NewReader(bytes.NewReader(out.Bytes()))
+	entries := []string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !header.ModTime.Equal(portableMtime) || header.Uid != 0 {
+			t.Errorf("%s: ModTime=%s Uid=%d; expected portable values",
+				header.Name, header.ModTime, header.Uid)
+		}
+		entries = append(entries, header.Name+" "+header.FileInfo().Mode().String())
+	}
+	expected := []string{
+		"opt/ drwxr-xr-x",
+		"opt/app/ drwxr-xr-x",
+		"opt/app/__main__.py -rw-r--r--",
+		"opt/app/pkg/ drwxr-xr-x",
+		"opt/app/pkg/sub/ drwxr-xr-x",
+		"opt/app/pkg/sub/a.py -rw-r--r--",
+		"opt/app/pkg/b.so -rwxr-xr-x",
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries=%#v; expected %#v", entries, expected)
+	}
+
+	again := &bytes.Buffer{}
+	err = writeTar(reader.File, "opt/app", again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), again.Bytes()) {
+		t.Error("writeTar output must be deterministic")
+	}
+}
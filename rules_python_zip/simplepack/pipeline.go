@@ -0,0 +1,284 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Number of entries each worker can prepare ahead of the writer. Limits memory use.
+const pendingEntriesPerWorker = 8
+
+// The entries of a wheel, read from the wheel or from a layer.
+type wheelContents struct {
+	Path  string
+	Files []*zip.File
+	// Layer entries are already named and encoded as they are in the output
+	FromLayer bool
+	reader    *zip.ReadCloser
+}
+
+// Returns the path of f within the output zip.
+func (w *wheelContents) OutputPath(f *zip.File) string {
+	if w.FromLayer {
+		return f.Name
+	}
+	// Handle code stored in <package>-<version>.data/purelib or platlib. See
+	// https://www.python.org/dev/peps/pep-0427/#what-s-the-deal-with-purelib-vs-platlib.
+	return handlePurelibPlatlib(f.Name)
+}
+
+// Reads the central directory of each wheel that is not in layers, in parallel. Each wheel is
+// opened once; call closeWheels when done.
+func openWheels(paths []string, layers *wheelLayers, workers int) ([]*wheelContents, error) {
+	wheels := make([]*wheelContents, len(paths))
+	errs := make([]error, len(paths))
+	work := make(chan int)
+	done := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range work {
+				reader, err := zip.OpenReader(paths[i])
+				if err != nil {
+					errs[i] = fmt.Errorf("Error loading %s: %s", paths[i], err)
+					continue
+				}
+				wheels[i] = &wheelContents{paths[i], reader.File, false, reader}
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i, path := range paths {
+		if files, ok := layers.Files(path); ok {
+			wheels[i] = &wheelContents{path, files, true, nil}
+			continue
+		}
+		work <- i
+	}
+	close(work)
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			closeWheels(wheels)
+			return nil, err
+		}
+	}
+	return wheels, nil
+}
+
+func closeWheels(wheels []*wheelContents) error {
+	var firstErr error
+	for _, wheel := range wheels {
+		if wheel == nil || wheel.reader == nil {
+			continue
+		}
+		err := wheel.reader.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		wheel.reader = nil
+	}
+	return firstErr
+}
+
+// An entry of the output zip. Exactly one of srcPath, wheelF or layerF is set.
+type packJob struct {
+	name    string
+	srcPath string
+	wheelF  *zip.File
+	layerF  *zip.File
+	// Written as a symlink to linkTarget instead of the contents of srcPath
+	linkTarget string
+	// Contents of srcPath or wheelF if they were already read, e.g. by tree shaking
+	data []byte
+	// Return the contents with the packed entry
+	keepData bool
+}
+
+// A packJob, encoded as it will be written.
+type packedEntry struct {
+	// Entry to copy to the output zip
+	file *zip.File
+	// Contents if the job had keepData
+	data []byte
+	err  error
+}
+
+// Encodes job as a single entry zip, exactly as cachedPathsZipWriter.CreateWithMethod
+// would write it, so the writer only has to copy the entry.
+func preparePackJob(job *packJob) *packedEntry {
+	if job.layerF != nil {
+		entry := &packedEntry{file: job.layerF}
+		if job.keepData && job.data != nil {
+			entry.data = job.data
+		} else if job.keepData {
+			entry.data, entry.err = readZipFile(job.layerF)
+		}
+		return entry
+	}
+
+	var fileinfo os.FileInfo
+	var r io.ReadCloser
+	var err error
+	if job.wheelF != nil {
+		fileinfo = job.wheelF.FileInfo()
+		if job.data != nil {
+			r = ioutil.NopCloser(bytes.NewReader(job.data))
+		} else {
+			r, err = job.wheelF.Open()
+		}
+	} else if job.linkTarget != "" {
+		fileinfo, err = os.Lstat(job.srcPath)
+		r = ioutil.NopCloser(strings.NewReader(job.linkTarget))
+	} else {
+		fileinfo, err = os.Stat(job.srcPath)
+		if err == nil && job.data != nil {
+			r = ioutil.NopCloser(bytes.NewReader(job.data))
+		} else if err == nil {
+			r, err = os.Open(job.srcPath)
+		}
+	}
+	if err != nil {
+		return &packedEntry{err: err}
+	}
+	defer r.Close()
+
+	header, err := zip.FileInfoHeader(fileinfo)
+	if err != nil {
+		return &packedEntry{err: err}
+	}
+	header.Name = job.name
+	header.Method = zipMethod
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return &packedEntry{err: err}
+	}
+	entry := &packedEntry{}
+	if job.keepData {
+		data := &bytes.Buffer{}
+		_, err = io.Copy(w, io.TeeReader(r, data))
+		entry.data = data.Bytes()
+	} else {
+		_, err = io.Copy(w, r)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = r.Close()
+	}
+	if err != nil {
+		return &packedEntry{err: err}
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		return &packedEntry{err: err}
+	}
+	entry.file = reader.File[0]
+	return entry
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf := &bytes.Buffer{}
+	_, err = io.Copy(buf, r)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), r.Close()
+}
+
+// Prepares packJobs in a pool of workers. Next returns the entries in the order of the jobs, so
+// a single writer produces the same output as preparing them one at a time. Call Close when
+// done, before closing the wheels the jobs read.
+type packPipeline struct {
+	results []chan *packedEntry
+	// Holds a token for each job that was started but not returned by Next
+	pending chan struct{}
+	next    int
+	// Closed by Close to stop starting jobs
+	done    chan struct{}
+	running sync.WaitGroup
+}
+
+func newPackPipeline(jobs []*packJob, workers int) *packPipeline {
+	p := &packPipeline{
+		results: make([]chan *packedEntry, len(jobs)),
+		pending: make(chan struct{}, workers*pendingEntriesPerWorker),
+		done:    make(chan struct{}),
+	}
+	for i := range p.results {
+		p.results[i] = make(chan *packedEntry, 1)
+	}
+
+	work := make(chan int)
+	p.running.Add(1 + workers)
+	go func() {
+		defer p.running.Done()
+		defer close(work)
+		for i := range jobs {
+			select {
+			case p.pending <- struct{}{}:
+			case <-p.done:
+				return
+			}
+			select {
+			case work <- i:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer p.running.Done()
+			for i := range work {
+				// results are buffered, so this never blocks
+				p.results[i] <- preparePackJob(jobs[i])
+			}
+		}()
+	}
+	return p
+}
+
+// Stops starting jobs and waits for the jobs that were started, e.g. if writing failed before
+// every entry was returned by Next.
+func (p *packPipeline) Close() {
+	close(p.done)
+	p.running.Wait()
+}
+
+// Returns the next entry, waiting until it is prepared.
+func (p *packPipeline) Next() (*packedEntry, error) {
+	entry := <-p.results[p.next]
+	p.results[p.next] = nil
+	p.next++
+	<-p.pending
+	return entry, entry.err
+}
+
+// Returns the number of workers to pack with.
+func packWorkers() int {
+	return runtime.NumCPU()
+}
+
+// Returns true if the contents of path must be passed to scanners.
+func needsScan(path string, scanners []sourceScanner) bool {
+	return len(scanners) > 0 && strings.HasSuffix(path, ".py")
+}
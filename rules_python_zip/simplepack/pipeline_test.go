@@ -0,0 +1,184 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Writes wheelF the way simplepack wrote entries before packPipeline.
+func writeSerial(t *testing.T, zw *cachedPathsZipWriter, wheelF *zip.File, name string) {
+	r, err := wheelF.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w, err := zw.CreateWithMethod(wheelF.FileInfo(), name, zipMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackPipelineIsIdentical(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	wheelFiles := map[string]string{}
+	for i := 0; i < 50; i++ {
+		wheelFiles[fmt.Sprintf("pkg/mod%02d.py", i)] = fmt.Sprintf("X = %d\n", i)
+	}
+	wheelPath := filepath.Join(tempDir, "pkg-1.0-py3-none-any.whl")
+	writeTestWheel(t, wheelPath, wheelFiles)
+	srcPath := filepath.Join(tempDir, "main.py")
+	err = ioutil.WriteFile(srcPath, []byte("import pkg\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial := &bytes.Buffer{}
+	zw := newCachedPathsZipWriter(serial)
+	stat, err := os.Stat(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := zw.CreateWithMethod(stat, "main.py", zipMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("import pkg\n"))
+	reader, err := zip.OpenReader(wheelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for _, wheelF := range reader.File {
+		writeSerial(t, zw, wheelF, wheelF.Name)
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noLayers, err := openLayers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 4} {
+		wheels, err := openWheels([]string{wheelPath}, noLayers, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs := []*packJob{{name: "main.py", srcPath: srcPath, keepData: true}}
+		for _, wheelF := range wheels[0].Files {
+			jobs = append(jobs, &packJob{name: wheels[0].OutputPath(wheelF), wheelF: wheelF})
+		}
+		concurrent := &bytes.Buffer{}
+		zw = newCachedPathsZipWriter(concurrent)
+		pipeline := newPackPipeline(jobs, workers)
+		defer pipeline.Close()
+		for i := range jobs {
+			entry, err := pipeline.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 && string(entry.data) != "import pkg\n" {
+				t.Errorf("entry.data=%#v; expected the contents of main.py", string(entry.data))
+			}
+			err = zw.Copy(entry.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = zw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = closeWheels(wheels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(serial.Bytes(), concurrent.Bytes()) {
+			t.Errorf("workers=%d: output differs from writing serially", workers)
+		}
+	}
+}
+
+func TestPackPipelineError(t *testing.T) {
+	jobs := []*packJob{
+		{name: "ok.py", srcPath: "pipeline_test.go"},
+		{name: "missing.py", srcPath: "does_not_exist.py"},
+	}
+	pipeline := newPackPipeline(jobs, 2)
+	defer pipeline.Close()
+	_, err := pipeline.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pipeline.Next()
+	if err == nil {
+		t.Error("Next() for a missing source should fail")
+	}
+}
+
+func TestPackPipelineCloseStopsWorkers(t *testing.T) {
+	before := runtime.NumGoroutine()
+	// more jobs than the workers can prepare ahead, so starting them blocks until Close
+	jobs := []*packJob{{name: "missing.py", srcPath: "does_not_exist.py"}}
+	for i := 0; i < 100; i++ {
+		jobs = append(jobs, &packJob{name: fmt.Sprintf("ok%d.py", i), srcPath: "pipeline_test.go"})
+	}
+	pipeline := newPackPipeline(jobs, 2)
+	_, err := pipeline.Next()
+	if err == nil {
+		t.Fatal("Next() for a missing source should fail")
+	}
+	pipeline.Close()
+	// goroutines that called Done may still be exiting
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Errorf("%d goroutines are running after Close; expected %d",
+			runtime.NumGoroutine(), before)
+	}
+}
+
+func TestPackJobReusesData(t *testing.T) {
+	// the contents tree shaking read are packed instead of the file, which is only stat'd
+	entry := preparePackJob(&packJob{name: "ok.py", srcPath: "pipeline_test.go",
+		data: []byte("X = 1\n"), keepData: true})
+	if entry.err != nil {
+		t.Fatal(entry.err)
+	}
+	data, err := readZipFile(entry.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "X = 1\n" || string(entry.data) != "X = 1\n" {
+		t.Errorf("packed %#v and kept %#v; expected the job's data", string(data), string(entry.data))
+	}
+}
+
+func TestOpenWheelsError(t *testing.T) {
+	noLayers, err := openLayers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = openWheels([]string{"does_not_exist.whl"}, noLayers, 2)
+	if err == nil {
+		t.Error("openWheels() for a missing wheel should fail")
+	}
+}
@@ -0,0 +1,48 @@
+package simplepack
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Checks that the tests in m are Python files in Sources.
+func validatePytestTests(m *Manifest) error {
+	sourceDsts := map[string]bool{}
+	for _, sourceMeta := range m.Sources {
+		sourceDsts[sourceMeta.Dst] = true
+	}
+	for _, test := range m.PytestTests {
+		if !strings.HasSuffix(test, ".py") {
+			return fmt.Errorf("pytest_tests: %#v is not a Python file", test)
+		}
+		if !sourceDsts[test] {
+			return fmt.Errorf("pytest_tests: %#v is not in Sources", test)
+		}
+	}
+	if m.TreeShake {
+		return fmt.Errorf("tree_shake cannot be used with pytest_tests")
+	}
+	return nil
+}
+
+// Returns the paths pytest must find as files: the tests, and the conftest.py files in
+// their directories or any parent directory.
+func pytestUnzipPaths(m *Manifest) []string {
+	testDirs := map[string]bool{}
+	for _, test := range m.PytestTests {
+		for dir := path.Dir(test); !testDirs[dir]; dir = path.Dir(dir) {
+			testDirs[dir] = true
+			if dir == "." {
+				break
+			}
+		}
+	}
+	paths := append([]string{}, m.PytestTests...)
+	for _, sourceMeta := range m.Sources {
+		if path.Base(sourceMeta.Dst) == "conftest.py" && testDirs[path.Dir(sourceMeta.Dst)] {
+			paths = append(paths, sourceMeta.Dst)
+		}
+	}
+	return paths
+}
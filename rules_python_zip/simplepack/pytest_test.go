@@ -0,0 +1,46 @@
+package simplepack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidatePytestTests(t *testing.T) {
+	sources := []ManifestSource{
+		{Src: "src/pkg/test_a.py", Dst: "pkg/test_a.py"},
+		{Src: "src/pkg/data.txt", Dst: "pkg/data.txt"},
+	}
+	err := validatePytestTests(&Manifest{Sources: sources, PytestTests: []string{"pkg/test_a.py"}})
+	if err != nil {
+		t.Error(err)
+	}
+	invalid := []*Manifest{
+		{Sources: sources, PytestTests: []string{"pkg/test_b.py"}},
+		{Sources: sources, PytestTests: []string{"pkg/data.txt"}},
+		{Sources: sources, PytestTests: []string{"pkg/test_a.py"}, TreeShake: true},
+	}
+	for _, m := range invalid {
+		err = validatePytestTests(m)
+		if err == nil {
+			t.Errorf("validatePytestTests(%#v)=nil; expected error", m.PytestTests)
+		}
+	}
+}
+
+func TestPytestUnzipPaths(t *testing.T) {
+	m := &Manifest{
+		Sources: []ManifestSource{
+			{Dst: "conftest.py"},
+			{Dst: "pkg/conftest.py"},
+			{Dst: "pkg/sub/test_a.py"},
+			{Dst: "other/conftest.py"},
+			{Dst: "pkg/sub/deeper/conftest.py"},
+		},
+		PytestTests: []string{"pkg/sub/test_a.py"},
+	}
+	expected := []string{"pkg/sub/test_a.py", "conftest.py", "pkg/conftest.py"}
+	paths := pytestUnzipPaths(m)
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("pytestUnzipPaths()=%#v; expected %#v", paths, expected)
+	}
+}
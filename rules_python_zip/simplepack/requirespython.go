@@ -0,0 +1,179 @@
+package simplepack
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Specifier operators, longest first so a prefix does not match a longer operator
+var specifierOperators = []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">"}
+
+// Returns the release segment of a PEP 440 version, e.g. [3, 6, 0] for "3.6.0rc1". Parsing stops
+// at the first part that is not a number.
+func parseReleaseVersion(version string) []int {
+	release := []int{}
+	for _, part := range strings.Split(strings.TrimSpace(version), ".") {
+		digits := part
+		for i, c := range part {
+			if c < '0' || c > '9' {
+				digits = part[:i]
+				break
+			}
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		release = append(release, n)
+		if len(digits) != len(part) {
+			break
+		}
+	}
+	return release
+}
+
+// Compares release versions, padding the shorter one with zeros.
+func compareReleases(a []int, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Returns true if version matches one clause of a specifier, like ">=3.6" or "!=3.0.*". Only
+// the release segment is compared: pre-releases and local versions are ignored. Must match
+// _matches_clause in pyz_runtime.requires_python.
+func matchesSpecifierClause(version []int, clause string) bool {
+	clause = strings.TrimSpace(clause)
+	operator := "=="
+	for _, op := range specifierOperators {
+		if strings.HasPrefix(clause, op) {
+			operator = op
+			break
+		}
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(clause, operator))
+	if operator == "===" {
+		parts := []string{}
+		for _, n := range version {
+			parts = append(parts, strconv.Itoa(n))
+		}
+		return strings.Join(parts, ".") == spec
+	}
+	if (operator == "==" || operator == "!=") && strings.HasSuffix(spec, ".*") {
+		prefix := parseReleaseVersion(strings.TrimSuffix(spec, ".*"))
+		padded := append(append([]int{}, version...), make([]int, len(prefix))...)
+		matches := compareReleases(padded[:len(prefix)], prefix) == 0
+		return matches == (operator == "==")
+	}
+	release := parseReleaseVersion(spec)
+	cmp := compareReleases(version, release)
+	switch operator {
+	case "~=":
+		// ~=3.6.1 is >=3.6.1, ==3.6.*
+		if cmp < 0 {
+			return false
+		}
+		if len(release) < 2 {
+			return true
+		}
+		padded := append(append([]int{}, version...), make([]int, len(release))...)
+		return compareReleases(padded[:len(release)-1], release[:len(release)-1]) == 0
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<=":
+		return cmp <= 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp > 0
+	}
+}
+
+// Returns true if version matches every clause of a Requires-Python specifier.
+func matchesSpecifier(version []int, specifier string) bool {
+	for _, clause := range strings.Split(specifier, ",") {
+		if strings.TrimSpace(clause) != "" && !matchesSpecifierClause(version, clause) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the releases of a target version like "3" or "2.7" to check specifiers against:
+// a specifier is compatible if one release of the target matches it.
+func targetReleases(target string) [][]int {
+	release := parseReleaseVersion(target)
+	if len(release) >= 3 {
+		return [][]int{release}
+	}
+	minors := [][]int{release}
+	if len(release) == 1 {
+		minors = [][]int{}
+		for minor := 0; minor < 30; minor++ {
+			minors = append(minors, []int{release[0], minor})
+		}
+	}
+	releases := [][]int{}
+	for _, minor := range minors {
+		// the first and any later patch release
+		releases = append(releases, minor, append(append([]int{}, minor...), 999))
+	}
+	return releases
+}
+
+// Returns true if a release of the target Python version matches specifier.
+func targetMatchesSpecifier(target string, specifier string) bool {
+	for _, release := range targetReleases(target) {
+		if matchesSpecifier(release, specifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the Requires-Python of each wheel that declares it, by wheel file name, and the
+// descriptions of the wheels that the target Python version does not match.
+func checkRequiresPython(
+	wheels []*wheelContents, target string,
+) (map[string]string, []string, error) {
+	requirements := map[string]string{}
+	incompatible := []string{}
+	for _, wheel := range wheels {
+		_, metadata, err := readWheelMetadata(wheel)
+		if err != nil {
+			return nil, nil, err
+		}
+		specifier := strings.TrimSpace(metadata.Get("Requires-Python"))
+		if specifier == "" {
+			continue
+		}
+		wheelName := filepath.Base(wheel.Path)
+		requirements[wheelName] = specifier
+		if !targetMatchesSpecifier(target, specifier) {
+			incompatible = append(incompatible,
+				fmt.Sprintf("%s: Requires-Python %s", wheelName, specifier))
+		}
+	}
+	sort.Strings(incompatible)
+	return requirements, incompatible, nil
+}
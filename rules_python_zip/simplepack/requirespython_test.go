@@ -0,0 +1,87 @@
+package simplepack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchesSpecifier(t *testing.T) {
+	tests := []struct {
+		version   string
+		specifier string
+		expected  bool
+	}{
+		{"2.7.18", ">=2.7", true},
+		{"2.7.18", ">=3.6", false},
+		{"3.6", ">=3.6.0", true},
+		{"3.7.1", ">=3.6, !=3.7.*", false},
+		{"3.8", ">=3.6, !=3.7.*", true},
+		{"3.1.2", ">=2.7, !=3.0.*, !=3.1.*, !=3.2.*", false},
+		{"2.7.18", ">=2.7, !=3.0.*, !=3.1.*, !=3.2.*", true},
+		{"3.6.5", "~=3.6.1", true},
+		{"3.7.0", "~=3.6.1", false},
+		{"3.9", "~=3.6", true},
+		{"4.0", "~=3.6", false},
+		{"3.6", "==3.6.0", true},
+		{"3.6", "<3.6", false},
+		{"3.5.9", "<=3.6,>3.5", true},
+		{"3.6.0", "===3.6.0", true},
+		{"3.6", ">=3.6.0rc1", true},
+		{"3.6", "", true},
+	}
+	for _, test := range tests {
+		output := matchesSpecifier(parseReleaseVersion(test.version), test.specifier)
+		if output != test.expected {
+			t.Errorf("matchesSpecifier(%#v, %#v)=%v; expected %v",
+				test.version, test.specifier, output, test.expected)
+		}
+	}
+}
+
+func TestTargetMatchesSpecifier(t *testing.T) {
+	tests := []struct {
+		target    string
+		specifier string
+		expected  bool
+	}{
+		{"2.7", ">=2.7.9", true},
+		{"2.7", ">=3.5", false},
+		{"2.7.8", ">=2.7.9", false},
+		{"3", ">=3.6", true},
+		{"3", "<3", false},
+		{"3.7", "!=3.7.*", false},
+	}
+	for _, test := range tests {
+		output := targetMatchesSpecifier(test.target, test.specifier)
+		if output != test.expected {
+			t.Errorf("targetMatchesSpecifier(%#v, %#v)=%v; expected %v",
+				test.target, test.specifier, output, test.expected)
+		}
+	}
+}
+
+func TestCheckRequiresPython(t *testing.T) {
+	wheels := []*wheelContents{
+		testWheelContents(t, "wheels/new-2.0-py3-none-any.whl", map[string]string{
+			"new-2.0.dist-info/METADATA": "Name: new\nVersion: 2.0\nRequires-Python: >=3.6\n",
+		}),
+		testWheelContents(t, "wheels/old-1.0-py2-none-any.whl", map[string]string{
+			"old-1.0.dist-info/METADATA": "Name: old\nVersion: 1.0\n",
+		}),
+	}
+	requirements, incompatible, err := checkRequiresPython(wheels, "2.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"new-2.0-py3-none-any.whl": ">=3.6"}
+	if !reflect.DeepEqual(requirements, expected) {
+		t.Errorf("requirements=%#v; expected %#v", requirements, expected)
+	}
+	if !reflect.DeepEqual(incompatible, []string{"new-2.0-py3-none-any.whl: Requires-Python >=3.6"}) {
+		t.Errorf("incompatible=%#v", incompatible)
+	}
+	_, incompatible, err = checkRequiresPython(wheels, "3.6")
+	if err != nil || len(incompatible) != 0 {
+		t.Errorf("checkRequiresPython(3.6)=%#v, %v; expected compatible", incompatible, err)
+	}
+}
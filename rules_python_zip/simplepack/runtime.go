@@ -0,0 +1,1069 @@
+package simplepack
+
+import (
+	"sort"
+	"strings"
+)
+
+// Package added to every zip so code can get information about the zip it runs from
+const runtimePackage = "pyz_runtime"
+
+// Files in runtimePackage, keyed by path within the package.
+var runtimeFiles = map[string]string{
+	"__init__.py": `'''Helpers for code running inside a zip built by simplepack.'''
+`,
+
+	"_zip.py": `'''Reads files stored next to the pyz_runtime package in the zip or unpacked dir.'''
+
+import errno
+import json
+import os
+import threading
+import zipimport
+
+ROOT = os.path.dirname(os.path.dirname(__file__))
+_package_info = []
+_names = []
+_lock = threading.Lock()
+
+# Directory where files are extracted, once extraction_dir() is called
+extract_dir = None
+# Extraction directories end with this suffix and contain the marker file, which is locked by
+# the process that created it. The lock is released when the process exits, even if it is
+# killed, so abandoned directories can be found and removed.
+EXTRACT_DIR_SUFFIX = '_pyzip'
+MARKER_NAME = '.pyz_lock'
+# Keeps the locked marker file open until exit
+_marker_files = []
+
+
+def is_zipped():
+    return isinstance(globals().get('__loader__'), zipimport.zipimporter)
+
+
+def read_root_data(path):
+    '''Returns the bytes of the file at path, relative to the root of the zip.'''
+    full_path = os.path.join(ROOT, path)
+    if is_zipped():
+        try:
+            return __loader__.get_data(full_path)
+        except IOError:
+            # raise the same error as open()
+            raise not_found(full_path)
+    with open(full_path, 'rb') as f:
+        return f.read()
+
+
+def package_info():
+    '''Returns the parsed ` + zipInfoPath + `.'''
+    if len(_package_info) == 0:
+        _package_info.append(json.loads(read_root_data('` + zipInfoPath + `').decode('utf-8')))
+    return _package_info[0]
+
+
+def zip_names():
+    '''Returns the set of paths stored in the zip.'''
+    if len(_names) == 0:
+        import zipfile
+        with zipfile.ZipFile(__loader__.archive) as package_zip:
+            _names.append(frozenset(package_zip.namelist()))
+    return _names[0]
+
+
+def not_found(path):
+    return IOError(errno.ENOENT, os.strerror(errno.ENOENT), path)
+
+
+def extraction_root():
+    '''Returns the directory that contains extraction directories: $PYZ_TMPDIR, the manifest's
+    extract_root or the system temporary directory.'''
+    import tempfile
+    root = os.environ.get('PYZ_TMPDIR') or package_info().get('extract_root')
+    if not root:
+        return tempfile.gettempdir()
+    root = os.path.expanduser(root)
+    try:
+        os.makedirs(root)
+    except OSError as e:
+        if e.errno != errno.EEXIST:
+            raise
+    return root
+
+
+def _try_lock(f, blocking):
+    import fcntl
+    flags = fcntl.LOCK_EX
+    if not blocking:
+        flags |= fcntl.LOCK_NB
+    try:
+        fcntl.flock(f.fileno(), flags)
+        return True
+    except (IOError, OSError):
+        return False
+
+
+def _write_marker(path):
+    try:
+        import fcntl
+    except ImportError:
+        return
+    # lock before renaming so other processes never see an unlocked marker
+    temp_path = os.path.join(path, MARKER_NAME + '.tmp')
+    f = open(temp_path, 'w')
+    fd_flags = fcntl.fcntl(f.fileno(), fcntl.F_GETFD)
+    fcntl.fcntl(f.fileno(), fcntl.F_SETFD, fd_flags | fcntl.FD_CLOEXEC)
+    _try_lock(f, True)
+    f.write('%d\n' % os.getpid())
+    f.flush()
+    os.rename(temp_path, os.path.join(path, MARKER_NAME))
+    _marker_files.append(f)
+
+
+def is_abandoned(path):
+    '''Returns True if path is an extraction directory whose process exited.'''
+    try:
+        import fcntl
+    except ImportError:
+        return False
+    try:
+        f = open(os.path.join(path, MARKER_NAME))
+    except IOError:
+        # not created by this version, or not finished being created
+        return False
+    try:
+        return _try_lock(f, False)
+    finally:
+        f.close()
+
+
+def clean_abandoned(root):
+    '''Removes the extraction directories in root left by processes that did not clean up, for
+    example because they were killed.'''
+    import shutil
+    try:
+        names = os.listdir(root)
+    except OSError:
+        return
+    for name in names:
+        path = os.path.join(root, name)
+        if name.endswith(EXTRACT_DIR_SUFFIX) and is_abandoned(path):
+            shutil.rmtree(path, ignore_errors=True)
+
+
+def _register_cleanup(path):
+    import atexit
+    import shutil
+    import signal
+    create_pid = os.getpid()
+
+    def remove():
+        # only delete the dir in the original process even in case of fork
+        if os.getpid() == create_pid:
+            shutil.rmtree(path, ignore_errors=True)
+    # can't use a finally handler in __main__: it gets invoked BEFORE tracebacks are printed
+    atexit.register(remove)
+
+    def remove_and_kill(signum, frame):
+        remove()
+        signal.signal(signum, signal.SIG_DFL)
+        os.kill(os.getpid(), signum)
+
+    # atexit does not run when a signal kills the process. Only replace the default action,
+    # which kills the process: the handler does the same after removing the dir. Handlers set
+    # by the application and ignored signals are not changed. SIGINT is not handled here:
+    # Python raises KeyboardInterrupt, which runs atexit when it exits the program.
+    for name in ('SIGHUP', 'SIGTERM'):
+        signum = getattr(signal, name, None)
+        if signum is None or signal.getsignal(signum) != signal.SIG_DFL:
+            continue
+        try:
+            signal.signal(signum, remove_and_kill)
+        except ValueError:
+            # signals can only be set from the main thread
+            pass
+
+
+def extraction_dir():
+    '''Returns the directory files are extracted to, creating it if needed. It is removed when
+    the process exits.'''
+    global extract_dir
+    with _lock:
+        if extract_dir is None:
+            import tempfile
+            root = extraction_root()
+            clean_abandoned(root)
+            path = tempfile.mkdtemp(EXTRACT_DIR_SUFFIX, dir=root)
+            _write_marker(path)
+            _register_cleanup(path)
+            extract_dir = path
+        return extract_dir
+
+
+def extract(path):
+    '''Extracts path, a file or directory in the zip, and returns the real path.'''
+    import zipfile
+    prefix = path.rstrip('/') + '/'
+    members = [n for n in zip_names() if n == path or n.startswith(prefix)]
+    if len(members) == 0:
+        raise not_found(path)
+    output_dir = extraction_dir()
+    with _lock:
+        with zipfile.ZipFile(__loader__.archive) as package_zip:
+            for member in sorted(members):
+                output_path = os.path.join(output_dir, member)
+                if os.path.exists(output_path):
+                    continue
+                package_zip.extract(member, output_dir)
+                # zipfile does not preserve permissions: https://bugs.python.org/issue15795
+                original_attr = package_zip.getinfo(member).external_attr >> 16
+                if original_attr != 0:
+                    os.chmod(output_path, original_attr)
+    return os.path.join(output_dir, path)
+`,
+
+	"info.py": `'''Information about how this zip was built.'''
+
+import copy
+
+from pyz_runtime import _zip
+
+
+def build_info():
+    '''Returns a dict with the Bazel target, stamp values and packed distributions.'''
+    return copy.deepcopy(_zip.package_info()['build_info'])
+
+
+def stamp(key, default=None):
+    '''Returns a build stamp value, like BUILD_SCM_REVISION or BUILD_TIMESTAMP.'''
+    return _zip.package_info()['build_info']['stamp'].get(key, default)
+
+
+def distributions():
+    '''Returns a dict of packed distribution name to version.'''
+    return dict((d['name'], d['version'])
+                for d in _zip.package_info()['build_info']['distributions'])
+`,
+
+	"isolation.py": `'''Makes selected distributions installed on the host importable, after __main__.py removed
+their directories from sys.path.'''
+
+import os
+import re
+import sys
+
+# top-level module name to the host directory containing it
+allowed_modules = {}
+
+
+def _normalize(name):
+    return re.sub(r'[-_.]+', '-', name).lower()
+
+
+def _top_level_modules(metadata_dir, project_name):
+    top_level_path = os.path.join(metadata_dir, 'top_level.txt')
+    if not os.path.exists(top_level_path):
+        return [project_name.replace('-', '_')]
+    with open(top_level_path) as f:
+        return [line.strip() for line in f if line.strip() != '']
+
+
+def find_distributions(paths, names):
+    '''Returns a dict of top-level module name to the directory in paths that contains it, for
+    the distributions in names.'''
+    wanted = set(_normalize(name) for name in names)
+    modules = {}
+    for path in paths:
+        if not os.path.isdir(path):
+            continue
+        for entry in sorted(os.listdir(path)):
+            base, extension = os.path.splitext(entry)
+            project_name = base.split('-')[0]
+            if extension not in ('.dist-info', '.egg-info') or _normalize(project_name) not in wanted:
+                continue
+            for module in _top_level_modules(os.path.join(path, entry), project_name):
+                modules.setdefault(module, path)
+    return modules
+
+
+class AllowedModuleFinder(object):
+    '''Finds the top-level modules of allowed distributions. It is last on sys.meta_path, so
+    modules in the zip take precedence.'''
+
+    def find_spec(self, fullname, path, target=None):
+        if path is not None or fullname not in allowed_modules:
+            return None
+        import importlib.machinery
+        return importlib.machinery.PathFinder.find_spec(fullname, [allowed_modules[fullname]])
+
+    # Python 2 import protocol
+    def find_module(self, fullname, path=None):
+        if path is not None or fullname not in allowed_modules:
+            return None
+        return self
+
+    def load_module(self, fullname):
+        import imp
+        module_file, pathname, description = imp.find_module(
+            fullname, [allowed_modules[fullname]])
+        try:
+            return imp.load_module(fullname, module_file, pathname, description)
+        finally:
+            if module_file is not None:
+                module_file.close()
+
+
+def allow_distributions(removed_paths, names):
+    '''Makes the distributions in names importable from removed_paths.'''
+    allowed_modules.update(find_distributions(removed_paths, names))
+    sys.meta_path.append(AllowedModuleFinder())
+`,
+
+	"metadata.py": `'''Makes importlib.metadata and pkg_resources find the distributions packed in the zip.'''
+
+import os
+import re
+import sys
+import zipimport
+
+_ARCHIVE = os.path.abspath(os.path.dirname(os.path.dirname(__file__)))
+# normalized project name to *.dist-info directory in the zip
+_dist_info = {}
+
+
+def _normalize(name):
+    return re.sub(r'[-_.]+', '-', name).lower()
+
+
+def _is_archive(path):
+    return path is not None and os.path.abspath(path) == _ARCHIVE
+
+
+def _zip_path_class():
+    '''Returns zipfile.Path, which is new in Python 3.8, or the zipp backport that the
+    importlib_metadata backport depends on. Returns None if neither exists.'''
+    import zipfile
+    path_class = getattr(zipfile, 'Path', None)
+    if path_class is None:
+        try:
+            from zipp import Path as path_class
+        except ImportError:
+            return None
+    return path_class
+
+
+class DistributionFinder(object):
+    '''Finds distributions for importlib.metadata (or the importlib_metadata backport).'''
+
+    def find_spec(self, *args, **kwargs):
+        return None
+
+    def find_module(self, *args, **kwargs):
+        return None
+
+    def invalidate_caches(self):
+        pass
+
+    def find_distributions(self, context=None):
+        name = getattr(context, 'name', None)
+        paths = getattr(context, 'path', sys.path)
+        if not any(_is_archive(p) for p in paths):
+            return
+        try:
+            from importlib.metadata import PathDistribution
+        except ImportError:
+            try:
+                from importlib_metadata import PathDistribution
+            except ImportError:
+                return
+        path_class = _zip_path_class()
+        if path_class is None:
+            return
+        if name is not None:
+            dist_info = _dist_info.get(_normalize(name))
+            dist_infos = [dist_info] if dist_info is not None else []
+        else:
+            dist_infos = sorted(_dist_info.values())
+        for dist_info in dist_infos:
+            yield PathDistribution(path_class(_ARCHIVE, dist_info + '/'))
+
+
+def _find_in_zip(original_finder):
+    '''Returns a pkg_resources finder that returns the dist-info directories in our zip. Their
+    precedence is DEVELOP_DIST so pkg_resources does not treat the zip as an egg and reorder
+    sys.path.'''
+    import pkg_resources
+
+    def find_distributions(importer, path_item, only=False):
+        if not _is_archive(path_item):
+            for dist in original_finder(importer, path_item, only):
+                yield dist
+            return
+        # the distributions are top-level for this path entry: return them even if only is set,
+        # so they are added to the working set and their entry points can be found
+        for dist_info in sorted(_dist_info.values()):
+            subpath = os.path.join(path_item, dist_info)
+            metadata = pkg_resources.EggMetadata(zipimport.zipimporter(subpath))
+            metadata.egg_info = subpath
+            yield pkg_resources.Distribution.from_location(
+                path_item, dist_info, metadata, precedence=pkg_resources.DEVELOP_DIST)
+    return find_distributions
+
+
+def _patch_pkg_resources(pkg_resources):
+    original_finder = pkg_resources._distribution_finders.get(
+        zipimport.zipimporter, pkg_resources.find_eggs_in_zip)
+    pkg_resources.register_finder(zipimport.zipimporter, _find_in_zip(original_finder))
+    # the master working set was built while importing: rebuild it with our finder
+    initialize = getattr(pkg_resources, '_initialize_master_working_set', None)
+    if initialize is not None:
+        initialize()
+
+
+class _PkgResourcesLoader(object):
+    '''Wraps the loader for pkg_resources to patch it after it is executed.'''
+
+    def __init__(self, loader):
+        self.loader = loader
+
+    def create_module(self, spec):
+        return None
+
+    def exec_module(self, module):
+        # pkg_resources uses __loader__ to find its own resources
+        module.__loader__ = self.loader
+        module.__spec__.loader = self.loader
+        self.loader.exec_module(module)
+        _patch_pkg_resources(module)
+
+
+class _PkgResourcesLegacyLoader(object):
+    '''Wraps loaders that do not support exec_module, like zipimporter before Python 3.10.'''
+
+    def __init__(self, loader):
+        self.loader = loader
+
+    def load_module(self, fullname):
+        module = self.loader.load_module(fullname)
+        _patch_pkg_resources(module)
+        return module
+
+
+class PkgResourcesHook(object):
+    '''Import hook that patches pkg_resources when it is first imported.'''
+
+    def find_spec(self, fullname, path, target=None):
+        if fullname != 'pkg_resources':
+            return None
+        sys.meta_path.remove(self)
+        import importlib.util
+        spec = importlib.util.find_spec(fullname)
+        if spec is not None:
+            if hasattr(spec.loader, 'exec_module'):
+                spec.loader = _PkgResourcesLoader(spec.loader)
+            else:
+                spec.loader = _PkgResourcesLegacyLoader(spec.loader)
+        return spec
+
+    # Python 2 import protocol
+    def find_module(self, fullname, path=None):
+        if fullname != 'pkg_resources':
+            return None
+        return self
+
+    def load_module(self, fullname):
+        sys.meta_path.remove(self)
+        module = __import__(fullname)
+        _patch_pkg_resources(module)
+        return module
+
+
+def install(dist_info):
+    '''Registers finders for the distributions in dist_info, a dict of normalized project name to
+    *.dist-info directory in the zip.'''
+    _dist_info.update(dist_info)
+    sys.meta_path.append(DistributionFinder())
+    if 'pkg_resources' in sys.modules:
+        _patch_pkg_resources(sys.modules['pkg_resources'])
+    else:
+        sys.meta_path.insert(0, PkgResourcesHook())
+`,
+
+	"coverage.py": `'''Line coverage of the first-party sources packed in this zip, for bazel coverage.
+
+When the zip is built with coverage and COVERAGE_DIR is set, __main__.py calls start(), which
+traces the lines that run in first-party sources. At exit, the lines are written to COVERAGE_DIR
+as an LCOV file with workspace paths, where Bazel collects them. Tests are not reported.'''
+
+import atexit
+import dis
+import json
+import os
+import sys
+import threading
+
+from pyz_runtime import _zip
+
+# zip path to the set of line numbers that ran
+_executed = {}
+# file name of running code to zip path, or None if it is not a first-party source
+_zip_paths = {}
+_roots = []
+# zip path to its entry in the coverage manifest
+_sources = {}
+
+
+def _zip_path(filename):
+    try:
+        return _zip_paths[filename]
+    except KeyError:
+        pass
+    zip_path = None
+    normalized = os.path.normpath(os.path.abspath(filename))
+    for root in _roots:
+        if normalized.startswith(root + '/'):
+            zip_path = normalized[len(root)+1:]
+            if zip_path not in _sources:
+                zip_path = None
+            break
+    _zip_paths[filename] = zip_path
+    return zip_path
+
+
+def _trace_calls(frame, event, arg):
+    if event != 'call':
+        return None
+    zip_path = _zip_path(frame.f_code.co_filename)
+    if zip_path is None:
+        return None
+    lines = _executed.setdefault(zip_path, set())
+
+    def trace_lines(frame, event, arg):
+        if event == 'line':
+            lines.add(frame.f_lineno)
+        return trace_lines
+    return trace_lines
+
+
+def executable_lines(source, filename):
+    '''Returns the line numbers in source that have code.'''
+    lines = set()
+    code_objects = [compile(source, filename, 'exec', 0, 1)]
+    while len(code_objects) > 0:
+        code = code_objects.pop()
+        for _, line in dis.findlinestarts(code):
+            # a def or class line runs in the enclosing code, not in its own
+            if line is not None and line > 0 and (
+                    code.co_name == '<module>' or line != code.co_firstlineno):
+                lines.add(line)
+        for const in code.co_consts:
+            if hasattr(const, 'co_code'):
+                code_objects.append(const)
+    return lines
+
+
+def lcov(reports):
+    '''Returns LCOV records for reports, a list of (workspace path, executable lines, executed
+    lines).'''
+    records = []
+    for path, lines, executed in reports:
+        records.append('SF:%s\n' % path)
+        for line in sorted(lines):
+            records.append('DA:%d,%d\n' % (line, 1 if line in executed else 0))
+        records.append('LH:%d\nLF:%d\nend_of_record\n' % (len(lines & executed), len(lines)))
+    return ''.join(records)
+
+
+def _write(coverage_dir):
+    sys.settrace(None)
+    threading.settrace(None)
+    reports = []
+    for zip_path in sorted(_sources):
+        try:
+            lines = executable_lines(_zip.read_root_data(zip_path), zip_path)
+        except (IOError, SyntaxError):
+            continue
+        reports.append((_sources[zip_path]['src'], lines, _executed.get(zip_path, set())))
+    # one file per process: Bazel merges all the .dat files in COVERAGE_DIR
+    out_path = os.path.join(coverage_dir, 'pyz_%d.dat' % os.getpid())
+    with open(out_path, 'w') as f:
+        f.write(lcov(reports))
+
+
+def start(coverage_dir, extract_dir=None):
+    '''Traces first-party code from now on and writes coverage_dir/pyz_(pid).dat at exit.'''
+    manifest = json.loads(_zip.read_root_data('` + coverageManifestPath + `').decode('utf-8'))
+    for source in manifest['sources']:
+        if source['dst'].endswith('.py') and not source['is_test']:
+            _sources[source['dst']] = source
+    _roots.append(os.path.normpath(os.path.abspath(_zip.ROOT)))
+    if extract_dir is not None:
+        _roots.append(os.path.normpath(extract_dir))
+    atexit.register(_write, coverage_dir)
+    threading.settrace(_trace_calls)
+    sys.settrace(_trace_calls)
+`,
+	"signature.py": `'''Checks the signature that simplepack stored in this zip.
+
+When the zip is built with a signature_check, __main__.py calls check() before running anything
+else. It detects zips that were modified or corrupted after they were signed. It cannot stop
+someone who can replace __main__.py: use "simplepack verify" with keys from a trusted source.'''
+
+import base64
+import binascii
+import hashlib
+import json
+import sys
+import zipfile
+
+SIGNATURE_PATH = '` + signatureManifestPath + `'
+# renamed in Python 3
+_BadZipFile = getattr(zipfile, 'BadZipFile', None) or zipfile.BadZipfile
+
+# ed25519 (RFC 8032) verification: the standard library does not implement it
+_P = 2**255 - 19
+_L = 2**252 + 27742317777372353535851937790883648493
+_D = -121665 * pow(121666, _P - 2, _P) % _P
+_SQRT_M1 = pow(2, (_P - 1) // 4, _P)
+
+
+def _from_le(data):
+    return int(binascii.hexlify(data[::-1]), 16)
+
+
+def _add(a, b):
+    # points in extended coordinates (X, Y, Z, T)
+    p1 = (a[1] - a[0]) * (b[1] - b[0]) % _P
+    p2 = (a[1] + a[0]) * (b[1] + b[0]) % _P
+    p3 = 2 * a[3] * b[3] * _D % _P
+    p4 = 2 * a[2] * b[2] % _P
+    e, f, g, h = p2 - p1, p4 - p3, p4 + p3, p2 + p1
+    return (e * f % _P, g * h % _P, f * g % _P, e * h % _P)
+
+
+def _multiply(scalar, point):
+    result = (0, 1, 1, 0)
+    while scalar > 0:
+        if scalar & 1:
+            result = _add(result, point)
+        point = _add(point, point)
+        scalar >>= 1
+    return result
+
+
+def _equal(a, b):
+    return ((a[0] * b[2] - b[0] * a[2]) % _P == 0 and
+        (a[1] * b[2] - b[1] * a[2]) % _P == 0)
+
+
+def _recover_x(y, sign):
+    if y >= _P:
+        return None
+    x2 = (y * y - 1) * pow(_D * y * y + 1, _P - 2, _P) % _P
+    if x2 == 0:
+        if sign:
+            return None
+        return 0
+    x = pow(x2, (_P + 3) // 8, _P)
+    if (x * x - x2) % _P != 0:
+        x = x * _SQRT_M1 % _P
+    if (x * x - x2) % _P != 0:
+        return None
+    if x & 1 != sign:
+        x = _P - x
+    return x
+
+
+def _decompress(data):
+    y = _from_le(data)
+    sign = y >> 255
+    y &= (1 << 255) - 1
+    x = _recover_x(y, sign)
+    if x is None:
+        return None
+    return (x, y, 1, x * y % _P)
+
+
+_BASE_Y = 4 * pow(5, _P - 2, _P) % _P
+_BASE = (_recover_x(_BASE_Y, 0), _BASE_Y, 1, _recover_x(_BASE_Y, 0) * _BASE_Y % _P)
+
+
+def verify_ed25519(public_key, message, signature):
+    '''Returns True if signature is a valid signature of message by the raw 32 byte public_key.'''
+    if len(public_key) != 32 or len(signature) != 64:
+        return False
+    a = _decompress(public_key)
+    r = _decompress(signature[:32])
+    s = _from_le(signature[32:])
+    if a is None or r is None or s >= _L:
+        return False
+    h = _from_le(hashlib.sha512(signature[:32] + public_key + message).digest()) % _L
+    return _equal(_multiply(s, _BASE), _add(r, _multiply(h, a)))
+
+
+def key_id(public_key):
+    return hashlib.sha256(public_key).hexdigest()[:16]
+
+
+def read_prefix(archive, package_zip):
+    '''Returns the bytes of archive before the first entry of package_zip, like the #! line.'''
+    start = min([info.header_offset for info in package_zip.infolist()] or [0])
+    f = open(archive, 'rb')
+    try:
+        return f.read(start)
+    finally:
+        f.close()
+
+
+def digest(prefix, package_zip):
+    '''Returns the digest of prefix, the bytes before the zip, and the entries of package_zip,
+    a ZipFile, that simplepack signed.'''
+    lines = [u'%s\n' % hashlib.sha256(prefix).hexdigest()]
+    for info in sorted(package_zip.infolist(), key=lambda info: info.filename):
+        if info.filename == SIGNATURE_PATH:
+            continue
+        h = hashlib.sha256()
+        f = package_zip.open(info)
+        try:
+            for chunk in iter(lambda: f.read(65536), b''):
+                h.update(chunk)
+        finally:
+            f.close()
+        lines.append(u'%s %o %s\n' % (h.hexdigest(), info.external_attr >> 16, info.filename))
+    return hashlib.sha256(u''.join(lines).encode('utf-8')).digest()
+
+
+def verify(archive, trusted_keys):
+    '''Returns None if archive is signed by one of trusted_keys, base64 raw public keys, or
+    a description of the problem.'''
+    package_zip = zipfile.ZipFile(archive)
+    try:
+        try:
+            signature = json.loads(package_zip.read(SIGNATURE_PATH).decode('utf-8'))
+        except KeyError:
+            return 'not signed'
+        keys = dict((key_id(key), key) for key in [base64.b64decode(k) for k in trusted_keys])
+        public_key = keys.get(signature['key_id'])
+        if public_key is None:
+            return 'signed by key %s, which is not trusted' % signature['key_id']
+        try:
+            entries_digest = digest(read_prefix(archive, package_zip), package_zip)
+        except _BadZipFile as e:
+            return 'corrupted: %s' % e
+    finally:
+        package_zip.close()
+    if binascii.hexlify(entries_digest).decode('ascii') != signature['digest']:
+        return 'the header or entries do not match the signed digest'
+    if not verify_ed25519(public_key, entries_digest, base64.b64decode(signature['signature'])):
+        return 'invalid signature by key %s' % signature['key_id']
+    return None
+
+
+def check(archive, trusted_keys, error):
+    '''Exits if error is True and archive is not signed by one of trusted_keys; otherwise
+    prints a warning.'''
+    problem = verify(archive, trusted_keys)
+    if problem is None:
+        return
+    if error:
+        sys.stderr.write('Error: %s: signature check failed: %s\n' % (archive, problem))
+        sys.exit(1)
+    sys.stderr.write('warning: %s: signature check failed: %s\n' % (archive, problem))
+`,
+	"testing.py": `'''Runs the tests packed in this zip with pytest, in the Bazel test environment.
+
+__main__.py calls main() when the zip is built with pytest_tests. It runs pytest in this process
+on the extracted test files, writes JUnit XML to XML_OUTPUT_FILE, runs only this shard's tests
+when the test is sharded, and passes TESTBRIDGE_TEST_ONLY (bazel test --test_filter) to -k.'''
+
+import os
+import sys
+
+
+class ShardPlugin(object):
+    '''Keeps every total_shards-th collected test, starting with shard_index.'''
+
+    def __init__(self, shard_index, total_shards):
+        self.shard_index = shard_index
+        self.total_shards = total_shards
+
+    def pytest_collection_modifyitems(self, config, items):
+        selected = []
+        deselected = []
+        for i, item in enumerate(items):
+            if i % self.total_shards == self.shard_index:
+                selected.append(item)
+            else:
+                deselected.append(item)
+        if len(deselected) > 0:
+            config.hook.pytest_deselected(items=deselected)
+            items[:] = selected
+
+
+def pytest_args(test_paths, args, environ):
+    '''Returns the pytest command line for test_paths and the command line args.'''
+    pytest_args = ['-p', 'no:cacheprovider']
+    if environ.get('XML_OUTPUT_FILE'):
+        pytest_args.append('--junitxml=' + environ['XML_OUTPUT_FILE'])
+    if environ.get('TESTBRIDGE_TEST_ONLY'):
+        pytest_args.extend(['-k', environ['TESTBRIDGE_TEST_ONLY']])
+    return pytest_args + list(args) + list(test_paths)
+
+
+def main(tests, root):
+    '''Runs pytest on tests, zip paths of files extracted under root, and exits.'''
+    import pytest
+
+    # the tests are extracted to a directory that is removed at exit
+    sys.dont_write_bytecode = True
+    plugins = []
+    total_shards = int(os.environ.get('TEST_TOTAL_SHARDS', '1'))
+    if total_shards > 1:
+        shard_index = int(os.environ.get('TEST_SHARD_INDEX', '0'))
+        plugins.append(ShardPlugin(shard_index, total_shards))
+        # tells Bazel this test supports sharding
+        if os.environ.get('TEST_SHARD_STATUS_FILE'):
+            open(os.environ['TEST_SHARD_STATUS_FILE'], 'w').close()
+
+    test_paths = [os.path.join(root, test) for test in tests]
+    exit_code = int(pytest.main(pytest_args(test_paths, sys.argv[1:], os.environ), plugins))
+    # a shard can have no tests
+    if exit_code == 5 and total_shards > 1:
+        exit_code = 0
+    sys.exit(exit_code)
+`,
+	"reentry.py": `'''Lets child processes run the console scripts and modules packed in this zip.
+
+When enabled, __main__.py calls install(), which creates a bin directory containing a wrapper
+for each console script and a pyz-python wrapper that acts like the python command, then puts
+it first on PATH. multiprocessing is configured to start children with pyz-python.'''
+
+import os
+import sys
+
+from pyz_runtime import _zip
+
+# Reserved arguments handled by __main__.py
+RUN_FLAG = '--pyz-run'
+PYTHON_FLAG = '--pyz-python'
+PYTHON_WRAPPER = 'pyz-python'
+
+# Directory containing the wrappers, once install() is called
+bin_dir = None
+
+
+def command(*args):
+    '''Returns the command line that runs this zip with args.'''
+    return [sys.executable, os.path.abspath(_zip.ROOT)] + list(args)
+
+
+def console_script_command(name, *args):
+    '''Returns the command line that runs a console script packed in this zip.'''
+    return command(RUN_FLAG, name, *args)
+
+
+def python_command(*args):
+    '''Returns the command line that runs python with this zip importable, e.g.
+    python_command('-m', 'mypkg.tool').'''
+    return command(PYTHON_FLAG, *args)
+
+
+def _quote(arg):
+    return "'" + arg.replace("'", "'\\''") + "'"
+
+
+def _write_wrapper(path, args):
+    with open(path, 'w') as f:
+        f.write('#!/bin/sh\nexec %s "$@"\n' % ' '.join(_quote(arg) for arg in args))
+    os.chmod(path, 0o755)
+
+
+def install(console_scripts):
+    '''Creates wrappers for console_scripts, a dict of name to entry point, and puts them on PATH.'''
+    global bin_dir
+    if os.name != 'posix':
+        return
+    bin_dir = os.path.join(_zip.extraction_dir(), 'bin')
+    if not os.path.isdir(bin_dir):
+        os.makedirs(bin_dir)
+    for name in sorted(console_scripts):
+        _write_wrapper(os.path.join(bin_dir, name), console_script_command(name))
+    python_path = os.path.join(bin_dir, PYTHON_WRAPPER)
+    _write_wrapper(python_path, python_command())
+    os.environ['PATH'] = bin_dir + os.pathsep + os.environ.get('PATH', '')
+
+    if sys.version_info >= (3, 4):
+        # the spawn and forkserver start methods run this executable with -c
+        import multiprocessing
+        multiprocessing.set_executable(python_path)
+`,
+
+	"requires_python.py": `'''Checks the interpreter against the Requires-Python of the distributions packed in this zip.
+
+When the zip is built with requires_python_check, __main__.py calls check() first, so running
+with the wrong Python version prints which distributions need another version, instead of
+failing later with a SyntaxError or ImportError.'''
+
+import sys
+
+_OPERATORS = ('===', '~=', '==', '!=', '<=', '>=', '<', '>')
+
+
+def _release(version):
+    '''Returns the release segment of a PEP 440 version as a list of ints.'''
+    release = []
+    for part in version.strip().split('.'):
+        digits = ''
+        for c in part:
+            if not c.isdigit():
+                break
+            digits += c
+        if digits == '':
+            break
+        release.append(int(digits))
+        if len(digits) != len(part):
+            break
+    return release
+
+
+def _compare(a, b):
+    length = max(len(a), len(b))
+    a = a + [0] * (length - len(a))
+    b = b + [0] * (length - len(b))
+    return (a > b) - (a < b)
+
+
+def _matches_clause(version, clause):
+    clause = clause.strip()
+    operator = '=='
+    for op in _OPERATORS:
+        if clause.startswith(op):
+            operator = op
+            break
+    spec = clause[len(operator):].strip() if clause.startswith(operator) else clause
+    if operator == '===':
+        return '.'.join(str(n) for n in version) == spec
+    if operator in ('==', '!=') and spec.endswith('.*'):
+        prefix = _release(spec[:-2])
+        matches = (version + [0] * len(prefix))[:len(prefix)] == prefix
+        return matches == (operator == '==')
+    release = _release(spec)
+    cmp = _compare(version, release)
+    if operator == '~=':
+        if cmp < 0:
+            return False
+        if len(release) < 2:
+            return True
+        prefix = release[:-1]
+        return (version + [0] * len(release))[:len(prefix)] == prefix
+    return {
+        '==': cmp == 0,
+        '!=': cmp != 0,
+        '<=': cmp <= 0,
+        '>=': cmp >= 0,
+        '<': cmp < 0,
+        '>': cmp > 0,
+    }[operator]
+
+
+def matches(version, specifier):
+    '''Returns True if version, a list of ints, matches every clause of specifier.'''
+    return all(_matches_clause(version, clause) for clause in specifier.split(',')
+        if clause.strip() != '')
+
+
+def check(requirements, error):
+    '''Checks the running interpreter against requirements, a dict of wheel to Requires-Python.
+    Exits if error is True; otherwise prints a warning.'''
+    version = list(sys.version_info[:3])
+    incompatible = ['  %s: Requires-Python %s' % (wheel, specifier)
+        for wheel, specifier in sorted(requirements.items()) if not matches(version, specifier)]
+    if len(incompatible) == 0:
+        return
+    message = 'this program needs another version of Python than %s (%s):\n%s\n' % (
+        '.'.join(str(n) for n in version), sys.executable, '\n'.join(incompatible))
+    if error:
+        sys.stderr.write('Error: ' + message)
+        sys.exit(1)
+    sys.stderr.write('warning: ' + message)
+`,
+	"resources.py": `'''Reads resource files packed with the code, the same way whether the zip is run zipped or
+unpacked. Resources are named by a package name and a path relative to that package, e.g.
+read_bytes('mypkg', 'data/config.json').'''
+
+import errno
+import io
+import os
+
+from pyz_runtime import _zip
+
+
+def _path(package, resource):
+    if resource.startswith('/') or '..' in resource.split('/'):
+        raise ValueError('resource must be a relative path: ' + resource)
+    parts = [p for p in package.split('.') + resource.split('/') if p != '']
+    return '/'.join(parts)
+
+
+def read_bytes(package, resource):
+    '''Returns the contents of a resource as bytes.'''
+    return _zip.read_root_data(_path(package, resource))
+
+
+def open_binary(package, resource):
+    '''Returns a file-like object for reading the resource as bytes.'''
+    path = _path(package, resource)
+    if _zip.is_zipped():
+        return io.BytesIO(_zip.read_root_data(path))
+    return io.open(os.path.join(_zip.ROOT, path), 'rb')
+
+
+def open_text(package, resource, encoding='utf-8', errors='strict'):
+    '''Returns a file-like object for reading the resource as text.'''
+    return io.TextIOWrapper(open_binary(package, resource), encoding=encoding, errors=errors)
+
+
+def listdir(package, resource=''):
+    '''Returns the sorted names of the entries in a resource directory.'''
+    path = _path(package, resource)
+    if not _zip.is_zipped():
+        return sorted(os.listdir(os.path.join(_zip.ROOT, path)))
+    prefix = path + '/' if path != '' else ''
+    entries = set()
+    for name in _zip.zip_names():
+        if name.startswith(prefix) and len(name) > len(prefix):
+            entries.add(name[len(prefix):].split('/')[0])
+    if len(entries) == 0:
+        raise OSError(errno.ENOENT, os.strerror(errno.ENOENT), path)
+    return sorted(entries)
+
+
+def filename(package, resource):
+    '''Returns a real filesystem path for a resource file or directory. When running zipped,
+    this extracts the resource to a temporary directory that is removed at exit.'''
+    path = _path(package, resource)
+    if not _zip.is_zipped():
+        full_path = os.path.join(_zip.ROOT, path)
+        if not os.path.exists(full_path):
+            raise _zip.not_found(full_path)
+        return full_path
+    return _zip.extract(path)
+`,
+}
+
+// Returns the zip paths of the runtime package files in sorted order.
+func runtimePaths() []string {
+	out := []string{}
+	for name := range runtimeFiles {
+		out = append(out, runtimePackage+"/"+name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Returns true if dst is reserved for files generated by simplepack.
+func isReservedPath(dst string) bool {
+	return dst == "__main__.py" || dst == zipInfoPath || dst == sourceMapPath ||
+		dst == coverageManifestPath || dst == signatureManifestPath || dst == sbomPath ||
+		dst == noticesPath ||
+		strings.HasPrefix(dst, runtimePackage+"/")
+}
@@ -0,0 +1,353 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Signature of the other entries, written last. Read by pyz_runtime.signature.
+const signatureManifestPath = "_signature_.json"
+
+// Values for Manifest.SignatureCheck: what the zip does at startup if its signature does not
+// match a trusted key.
+const (
+	signatureCheckOff   = ""
+	signatureCheckWarn  = "warn"
+	signatureCheckError = "error"
+)
+
+const signatureAlgorithm = "ed25519"
+
+type zipSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	// Hex sha256 of the prefix and the entry list: see zipDigest
+	Digest string `json:"digest"`
+	// Base64 signature of the digest bytes
+	Signature string `json:"signature"`
+}
+
+// Returns a short identifier for a public key: the start of its hex sha256.
+func keyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+func readPEMFile(filePath string, blockType string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: expected a PEM %s block", filePath, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// Reads a PKCS #8 PEM ed25519 private key, like "openssl genpkey -algorithm ed25519" writes.
+func readPrivateKeyFile(filePath string) (ed25519.PrivateKey, error) {
+	der, err := readPEMFile(filePath, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filePath, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", filePath)
+	}
+	return privateKey, nil
+}
+
+// Reads a PKIX PEM ed25519 public key, like "openssl pkey -pubout" writes.
+func ReadPublicKeyFile(filePath string) (ed25519.PublicKey, error) {
+	der, err := readPEMFile(filePath, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filePath, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", filePath)
+	}
+	return publicKey, nil
+}
+
+// Checks the signing settings in m and returns the key to sign with, or nil.
+func loadSigningKey(m *Manifest) (ed25519.PrivateKey, error) {
+	switch m.SignatureCheck {
+	case signatureCheckOff, signatureCheckWarn, signatureCheckError:
+	default:
+		return nil, fmt.Errorf("invalid signature_check: %#v", m.SignatureCheck)
+	}
+	if m.SigningKey == "" {
+		if m.SignatureCheck != signatureCheckOff || len(m.TrustedKeys) > 0 {
+			return nil, fmt.Errorf("signature_check and trusted_keys require signing_key")
+		}
+		return nil, nil
+	}
+	if m.OutputFormat != outputZip {
+		return nil, fmt.Errorf("signing_key requires the zip output format")
+	}
+	if m.SignatureCheck == signatureCheckOff && len(m.TrustedKeys) > 0 {
+		return nil, fmt.Errorf("trusted_keys requires signature_check")
+	}
+	return readPrivateKeyFile(m.SigningKey)
+}
+
+// Returns the raw public keys the zip trusts at startup: TrustedKeys, or the signing key.
+func trustedPublicKeys(m *Manifest, signingKey ed25519.PrivateKey) ([]ed25519.PublicKey, error) {
+	if len(m.TrustedKeys) == 0 {
+		if signingKey == nil {
+			return nil, fmt.Errorf("signature_check requires signing_key or trusted_keys")
+		}
+		return []ed25519.PublicKey{signingKey.Public().(ed25519.PublicKey)}, nil
+	}
+	keys := []ed25519.PublicKey{}
+	for _, keyPath := range m.TrustedKeys {
+		key, err := ReadPublicKeyFile(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Size of a zip local file header without the name and extra field
+const zipLocalHeaderLen = 30
+
+// Returns the offset of the local file header of f in r. Only the offset of its data is known,
+// which follows the header, name and extra field.
+func zipLocalHeaderOffset(r io.ReaderAt, f *zip.File) (int64, error) {
+	dataOffset, err := f.DataOffset()
+	if err != nil {
+		return 0, err
+	}
+	nameEnd := dataOffset - int64(len(f.Name))
+	for extraLen := int64(0); extraLen <= 0xffff && nameEnd-extraLen-zipLocalHeaderLen >= 0; extraLen++ {
+		offset := nameEnd - extraLen - zipLocalHeaderLen
+		header := make([]byte, zipLocalHeaderLen)
+		_, err = r.ReadAt(header, offset)
+		if err != nil {
+			return 0, err
+		}
+		if binary.LittleEndian.Uint32(header) == 0x04034b50 &&
+			int(binary.LittleEndian.Uint16(header[26:])) == len(f.Name) &&
+			int64(binary.LittleEndian.Uint16(header[28:])) == extraLen {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: local file header not found", f.Name)
+}
+
+// Returns the bytes of r before the first entry, like the #! line of an executable zip.
+func zipPrefix(r io.ReaderAt, files []*zip.File) ([]byte, error) {
+	start := int64(0)
+	for i, f := range files {
+		offset, err := zipLocalHeaderOffset(r, f)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || offset < start {
+			start = offset
+		}
+	}
+	prefix := make([]byte, start)
+	_, err := r.ReadAt(prefix, 0)
+	if err != nil {
+		return nil, err
+	}
+	return prefix, nil
+}
+
+// Returns the sha256 of a line with the hex sha256 of prefix, the bytes before the first entry,
+// followed by the canonical list of entries, sorted by name: a line of
+// "(hex sha256 of the contents) (octal Unix mode bits) (name)" for each entry except the
+// signature. pyz_runtime.signature computes the same digest.
+func zipDigest(prefix []byte, files []*zip.File) ([]byte, error) {
+	sorted := append([]*zip.File{}, files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	list := &bytes.Buffer{}
+	fmt.Fprintf(list, "%x\n", sha256.Sum256(prefix))
+	for _, f := range sorted {
+		if f.Name == signatureManifestPath {
+			continue
+		}
+		if strings.Contains(f.Name, "\n") {
+			return nil, fmt.Errorf("cannot sign an entry with a newline in its name: %#v", f.Name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(list, "%x %o %s\n", h.Sum(nil), f.ExternalAttrs>>16, f.Name)
+	}
+	sum := sha256.Sum256(list.Bytes())
+	return sum[:], nil
+}
+
+// Rewrites the zip at zipPath with a signature of header and its entries as the last entry.
+// The zip starts with header, e.g. the #! line.
+func signZipFile(zipPath string, header []byte, key ed25519.PrivateKey) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	digest, err := zipDigest(header, reader.File)
+	if err != nil {
+		return err
+	}
+	signature := &zipSignature{
+		signatureAlgorithm,
+		keyID(key.Public().(ed25519.PublicKey)),
+		hex.EncodeToString(digest),
+		base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest)),
+	}
+	signatureJSON, err := json.Marshal(signature)
+	if err != nil {
+		return err
+	}
+
+	signedPath := zipPath + ".signed.tmp"
+	outFile, err := os.OpenFile(signedPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(signedPath)
+	defer outFile.Close()
+	_, err = outFile.Write(header)
+	if err != nil {
+		return err
+	}
+	// offsets are relative to the start of the zip, like the unsigned zip
+	zipWriter := zip.NewWriter(outFile)
+	for _, f := range reader.File {
+		err = zipWriter.Copy(f)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: signatureManifestPath, Method: zipMethod})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(signatureJSON)
+	if err != nil {
+		return err
+	}
+	err = zipWriter.Close()
+	if err != nil {
+		return err
+	}
+	err = outFile.Close()
+	if err != nil {
+		return err
+	}
+	err = reader.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(signedPath, zipPath)
+}
+
+// Checks that the prefix and entries of the zip in r are signed by one of keys. Returns the
+// signing key's ID.
+func verifyZipSignature(r io.ReaderAt, files []*zip.File, keys []ed25519.PublicKey) (string, error) {
+	var signatureFile *zip.File
+	for _, f := range files {
+		if f.Name == signatureManifestPath {
+			signatureFile = f
+		}
+	}
+	if signatureFile == nil {
+		return "", fmt.Errorf("not signed: %s is missing", signatureManifestPath)
+	}
+	data, err := readZipFile(signatureFile)
+	if err != nil {
+		return "", err
+	}
+	signature := &zipSignature{}
+	err = json.Unmarshal(data, signature)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %s", signatureManifestPath, err)
+	}
+	if signature.Algorithm != signatureAlgorithm {
+		return "", fmt.Errorf("unsupported signature algorithm: %#v", signature.Algorithm)
+	}
+	var key ed25519.PublicKey
+	for _, trusted := range keys {
+		if keyID(trusted) == signature.KeyID {
+			key = trusted
+		}
+	}
+	if key == nil {
+		return "", fmt.Errorf("signed by key %s, which is not trusted", signature.KeyID)
+	}
+
+	prefix, err := zipPrefix(r, files)
+	if err != nil {
+		return "", err
+	}
+	digest, err := zipDigest(prefix, files)
+	if err != nil {
+		return "", err
+	}
+	if hex.EncodeToString(digest) != signature.Digest {
+		return "", fmt.Errorf("the header or entries do not match the signed digest")
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil || !ed25519.Verify(key, digest, signatureBytes) {
+		return "", fmt.Errorf("invalid signature by key %s", signature.KeyID)
+	}
+	return signature.KeyID, nil
+}
+
+// Checks that the zip at zipPath is signed by one of keys. Returns the signing key's ID.
+func VerifyFile(zipPath string, keys []ed25519.PublicKey) (string, error) {
+	f, err := os.Open(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	reader, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", zipPath, err.Error())
+	}
+	id, err := verifyZipSignature(f, reader.File, keys)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", zipPath, err.Error())
+	}
+	return id, nil
+}
@@ -0,0 +1,136 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignZipFile(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	zipPath := filepath.Join(tempDir, "signed.pyz")
+	header := []byte("#!/usr/bin/env python3\n")
+	writeTestWheel(t, zipPath, map[string]string{"__main__.py": "print(1)", "a/b.py": "x = 1"})
+	data, err := ioutil.ReadFile(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(zipPath, append(header, data...), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signZipFile(zipPath, header, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ioutil.ReadFile(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(signed, header) {
+		t.Error("signed zip must start with the header")
+	}
+	reader, err := zip.NewReader(bytes.NewReader(signed), int64(len(signed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.File[len(reader.File)-1].Name != signatureManifestPath {
+		t.Errorf("the signature must be the last entry")
+	}
+	id, err := verifyZipSignature(bytes.NewReader(signed), reader.File,
+		[]ed25519.PublicKey{otherKey, publicKey})
+	if err != nil || id != keyID(publicKey) {
+		t.Errorf("verifyZipSignature()=%#v, %v; expected %#v", id, err, keyID(publicKey))
+	}
+	_, err = verifyZipSignature(bytes.NewReader(signed), reader.File, []ed25519.PublicKey{otherKey})
+	if err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("verifyZipSignature(other key)=%v; expected not trusted", err)
+	}
+
+	// a different #! line
+	swapped := append([]byte("#!/tmp/evil/python\n"), signed[len(header):]...)
+	swappedReader, err := zip.NewReader(bytes.NewReader(swapped), int64(len(swapped)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyZipSignature(bytes.NewReader(swapped), swappedReader.File,
+		[]ed25519.PublicKey{publicKey})
+	if err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("verifyZipSignature(other #! line)=%v; expected digest mismatch", err)
+	}
+
+	// a modified entry with a valid CRC
+	modified := bytes.NewBuffer(append([]byte{}, header...))
+	zw := zip.NewWriter(modified)
+	zw.SetOffset(int64(len(header)))
+	for _, f := range reader.File {
+		if f.Name != "a/b.py" {
+			err = zw.Copy(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("x = 2"))
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err = zip.NewReader(bytes.NewReader(modified.Bytes()), int64(modified.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyZipSignature(bytes.NewReader(modified.Bytes()), reader.File,
+		[]ed25519.PublicKey{publicKey})
+	if err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("verifyZipSignature(modified)=%v; expected digest mismatch", err)
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	invalid := []*Manifest{
+		{SignatureCheck: "maybe"},
+		{SignatureCheck: signatureCheckError},
+		{TrustedKeys: []string{"pub.pem"}},
+		{SigningKey: "key.pem", OutputFormat: outputDir},
+		{SigningKey: "key.pem", TrustedKeys: []string{"pub.pem"}},
+	}
+	for _, m := range invalid {
+		_, err := loadSigningKey(m)
+		if err == nil {
+			t.Errorf("loadSigningKey(%#v)=nil; expected error", m)
+		}
+	}
+	key, err := loadSigningKey(&Manifest{})
+	if key != nil || err != nil {
+		t.Errorf("loadSigningKey(unsigned)=%v, %v; expected nil, nil", key, err)
+	}
+	_, err = trustedPublicKeys(&Manifest{SignatureCheck: signatureCheckWarn}, nil)
+	if err == nil {
+		t.Error("trustedPublicKeys() without keys should fail")
+	}
+}
@@ -0,0 +1,1629 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TODO: Make store/deflate toggleable? Store should be faster
+const zipMethod = zip.Store
+const DefaultInterpreterLine = "/usr/bin/env python2.7"
+const zipInfoPath = "_zip_info_.json"
+
+// Values for the build-time checks, e.g. Manifest.ZipSafetyCheck
+const (
+	checkOff   = ""
+	checkWarn  = "warn"
+	checkError = "error"
+)
+
+var purelibRe = regexp.MustCompile("[^/]*-[\\.0-9]*\\.data/purelib/")
+var platlibRe = regexp.MustCompile("[^/]*-[\\.0-9]*\\.data/platlib/")
+var interpreterVersionRe = regexp.MustCompile(`python([0-9](?:\.[0-9]+)?)`)
+
+type ManifestSource struct {
+	// A file, or a directory that is packed recursively under Dst
+	Src string
+	Dst string
+	// Set for symlinks in directories when the manifest stores symlinks
+	LinkTarget string `json:"-"`
+}
+
+type Manifest struct {
+	Sources         []ManifestSource
+	Wheels          []string
+	EntryPoint      string `json:"entry_point"`
+	Interpreter     bool
+	InterpreterPath string `json:"interpreter_path"`
+	// Command name to entry point for a multicall zip, which runs the command named by the
+	// basename of argv[0] or by the first argument. An entry point is a module,
+	// "module:function" or the Dst of a script in Sources.
+	EntryPoints map[string]string `json:"entry_points"`
+	// TODO: Keep only one of these attributes?
+	ForceUnzip    []string `json:"force_unzip"`
+	ForceAllUnzip bool     `json:"force_all_unzip"`
+	// Directory for extracted files; $PYZ_TMPDIR overrides it. Defaults to the temp directory
+	ExtractRoot string `json:"extract_root"`
+	// One of "", "warn", "error" or "unzip": what to do with code that is probably not zip safe
+	ZipSafetyCheck  string   `json:"zip_safety_check"`
+	ZipSafetyIgnore []string `json:"zip_safety_ignore"`
+	// Python version the zip will run with, e.g. "2.7". Defaults to the InterpreterPath version
+	PythonVersion string `json:"python_version"`
+	// One of "", "warn" or "error": what to do with imports that cannot be resolved
+	ImportCheck      string   `json:"import_check"`
+	ImportCheckAllow []string `json:"import_check_allow"`
+	// One of "", "warn" or "error": what to do with Wheels whose Requires-Python does not match
+	// PythonVersion. The zip also checks the interpreter it runs with, and warns or exits
+	RequiresPythonCheck string `json:"requires_python_check"`
+	// Drop modules that are not reachable from the entry point, except those matching
+	// TreeShakeKeep. The dropped paths are written to TreeShakeReport, if set.
+	TreeShake       bool     `json:"tree_shake"`
+	TreeShakeKeep   []string `json:"tree_shake_keep"`
+	TreeShakeReport string   `json:"tree_shake_report"`
+	// Rewrite file names in tracebacks and log records to workspace paths
+	SourceMapTracebacks bool `json:"source_map_tracebacks"`
+	// Put wrappers for console scripts and the interpreter on PATH so child processes can
+	// run code from the zip
+	SubprocessReentry bool `json:"subprocess_reentry"`
+	// Which paths of the host Python installation stay on sys.path
+	SysPath SysPathPolicy `json:"sys_path"`
+	// Dsts of test files in Sources to run with pytest, which must be packed, instead of an
+	// entry point. Runs in the Bazel test environment: see pyz_runtime.testing
+	PytestTests []string `json:"pytest_tests"`
+	// Modules to import before the entry point, in order; "module:function" also calls function
+	InitModules []string `json:"init_modules"`
+	// Environment variables to set if the process was not started with them
+	DefaultEnv map[string]string `json:"default_env"`
+	// Arguments to insert before the arguments the zip is run with
+	DefaultArgs []string `json:"default_args"`
+	// Embed a list of the first-party sources, and write line coverage for them when run with
+	// $COVERAGE_DIR set. The list is also written to CoverageManifest, if set.
+	Coverage         bool   `json:"coverage"`
+	CoverageManifest string `json:"coverage_manifest"`
+	// Embed an SPDX bill of materials and the license notices of the Wheels. They are also
+	// written to SBOMFile and NoticesFile, if set.
+	SBOM        bool   `json:"sbom"`
+	SBOMFile    string `json:"sbom_file"`
+	NoticesFile string `json:"notices_file"`
+	// One of "", "warn" or "error": what to do with wheels whose license is missing or unknown
+	LicenseCheck string `json:"license_check"`
+	// One of "" (follow) or "store": how to pack symlinks in source directories
+	SourceSymlinks string `json:"source_symlinks"`
+	// Write a layer zip of the Wheels for other builds to list in Layers, instead of a zip
+	// that can run
+	Layer bool `json:"layer"`
+	// Layer zips with prebuilt entries for some of the Wheels
+	Layers []string `json:"layers"`
+	// Wheels to pack, by path or file name, when other Wheels install the same project. Packing
+	// a project more than once is an error otherwise
+	PreferredWheels []string `json:"preferred_wheels"`
+	// One of "" (an executable zip), "dir", "tar", "tar.gz" or "oci_layer"
+	OutputFormat string `json:"output_format"`
+	// Directory in a tarball to put the files in. Defaults to /app for "oci_layer"
+	InstallPrefix string `json:"install_prefix"`
+	// Path to write the digests and image config of an "oci_layer" to
+	OCIMetadata string `json:"oci_metadata"`
+	// Entrypoint for the image config. Defaults to InterpreterPath and the install prefix
+	OCIEntrypoint []string `json:"oci_entrypoint"`
+	// PEM ed25519 private key file to sign the entries with
+	SigningKey string `json:"signing_key"`
+	// One of "", "warn" or "error": what the zip does at startup if it is not signed by one of
+	// TrustedKeys, PEM public key files. They default to the SigningKey's public key
+	SignatureCheck string   `json:"signature_check"`
+	TrustedKeys    []string `json:"trusted_keys"`
+	// Label of the Bazel target that built this zip
+	Target string `json:"target"`
+	// Build stamp values; StampFiles are workspace status files with lines of "KEY value"
+	Stamp      map[string]string `json:"stamp"`
+	StampFiles []string          `json:"stamp_files"`
+}
+
+// Returns the Python version the zip targets.
+func (m *Manifest) targetPythonVersion() string {
+	if m.PythonVersion != "" {
+		return m.PythonVersion
+	}
+	interpreterPath := m.InterpreterPath
+	if interpreterPath == "" {
+		interpreterPath = DefaultInterpreterLine
+	}
+	match := interpreterVersionRe.FindStringSubmatch(interpreterPath)
+	if match == nil {
+		return "2.7"
+	}
+	return match[1]
+}
+
+// Returns value, strings and containers of strings, as a Python literal for the templates.
+func pythonLiteral(value interface{}) string {
+	// JSON string escapes are valid Python and encoding/json sorts map keys. Python 2 str
+	// literals do not decode \u escapes, so <, > and & must not be escaped as HTML.
+	out := &bytes.Buffer{}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		panic(err)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+type mainArgs struct {
+	ScriptPath          string
+	EntryPoint          string
+	Interpreter         bool
+	SourceMapTracebacks bool
+	SubprocessReentry   bool
+	SysPath             *sysPathArgs
+	// Python literals; empty if not set
+	InitModules string
+	DefaultEnv  string
+	DefaultArgs string
+	// Python dict literal of command name to (kind, entry point)
+	Commands string
+	// Python list literal of test files to run with pytest
+	PytestTests string
+	// Runs from a directory, never from a zip
+	Unpacked bool
+	Coverage bool
+	// Python dict literal of wheel to Requires-Python; empty if not checked
+	RequiresPython      string
+	RequiresPythonError bool
+	// Python list literal of base64 public keys to check the signature with; empty if not set
+	TrustedKeys         string
+	SignatureCheckError bool
+}
+
+type packageInfo struct {
+	UnzipPaths    []string   `json:"unzip_paths"`
+	ForceAllUnzip bool       `json:"force_all_unzip"`
+	BuildInfo     *buildInfo `json:"build_info"`
+	// Normalized project name to *.dist-info directory
+	DistInfo map[string]string `json:"dist_info"`
+	// Console script name to entry point, including multicall commands
+	ConsoleScripts map[string]string `json:"console_scripts"`
+	ExtractRoot    string            `json:"extract_root"`
+}
+
+func isPyFile(path string) bool {
+	return strings.HasSuffix(path, ".py") || strings.HasSuffix(path, ".pyc") || strings.HasSuffix(path, ".pyo")
+}
+
+// Inspects the contents of files as they are packed.
+type sourceScanner interface {
+	Scan(path string, data []byte)
+}
+
+// Passes the contents of filePath to scanners if it is a Python source file.
+func scanSource(filePath string, data []byte, scanners []sourceScanner) {
+	if !needsScan(filePath, scanners) {
+		return
+	}
+	for _, scanner := range scanners {
+		scanner.Scan(filePath, data)
+	}
+}
+
+// Takes e.g. "numpy-1.14.2.data/purelib/blah/stuff.py" and returns "blah/stuff.py". See
+// https://www.python.org/dev/peps/pep-0427/#what-s-the-deal-with-purelib-vs-platlib.
+func handlePurelibPlatlib(path string) string {
+	newPath := path
+	newPath = purelibRe.ReplaceAllLiteralString(newPath, "")
+	newPath = platlibRe.ReplaceAllLiteralString(newPath, "")
+	return newPath
+}
+
+// Returns the paths in the zip that are unzipped at startup, other than ForceUnzip: native code,
+// pytest tests and the packages that zipSafety found, if ZipSafetyCheck unzips them. zipSafety
+// may be nil.
+func computedUnzipPaths(m *Manifest, paths []string, zipSafety *zipSafetyScanner) []string {
+	unzipPaths := []string{}
+	if zipSafety != nil && m.ZipSafetyCheck == zipSafetyUnzip {
+		unzipPaths = append(unzipPaths, zipSafety.UnzipPaths(paths)...)
+	}
+	// pytest collects tests and conftest.py files from the file system
+	unzipPaths = append(unzipPaths, pytestUnzipPaths(m)...)
+	return append(unzipPaths, filterUnzipPaths(paths)...)
+}
+
+// Returns the list of paths that need to be unzipped.
+func filterUnzipPaths(paths []string) []string {
+	// find directories containing native code
+	nativeLibDirs := map[string]bool{}
+	for _, path := range paths {
+		// Versioned shared libs can have names like libffi-45372312.so.6.0.4
+		// Mac libs have both .so and .dylib
+		file := filepath.Base(path)
+		if strings.HasSuffix(file, ".so") || strings.Contains(file, ".so.") || strings.HasSuffix(file, ".dylib") {
+			nativeLibDirs[filepath.Dir(path)] = true
+		}
+	}
+
+	// unzip all non-Python things in dirs containing native code, in case the code references it.
+	// E.g. gRPC needs to find certificates in a sub dir
+	output := []string{}
+	for _, path := range paths {
+		// Leave python files in the zip
+		if isPyFile(path) {
+			continue
+		}
+
+		for nativeLibDir := range nativeLibDirs {
+			if strings.HasPrefix(path, nativeLibDir+"/") || (nativeLibDir == "." && !strings.ContainsRune(path, '/')) {
+				output = append(output, path)
+				break
+			}
+		}
+	}
+	return output
+}
+
+// Returns the paths to unzip for m.ForceUnzip, which lists paths in the zip and wheels. packed
+// are the wheels selectDistributions returned: the other wheels in m.Wheels are not packed, so
+// they are skipped. contains returns true if a path is in the zip.
+func forceUnzipPaths(
+	m *Manifest, packed []*wheelContents, contains func(string) bool,
+) ([]string, error) {
+	packedWheels := map[string]*wheelContents{}
+	for _, wheel := range packed {
+		packedWheels[wheel.Path] = wheel
+	}
+	dropped := map[string]bool{}
+	for _, wheelPath := range m.Wheels {
+		dropped[wheelPath] = packedWheels[wheelPath] == nil
+	}
+
+	unzipPaths := []string{}
+	for _, forceUnzipPath := range m.ForceUnzip {
+		// forceUnzipPaths might be wheels
+		wheel := packedWheels[forceUnzipPath]
+		if dropped[forceUnzipPath] {
+			continue
+		} else if wheel != nil && !wheel.FromLayer {
+			for _, wheelF := range wheel.Files {
+				unzipPaths = append(unzipPaths, wheelF.Name)
+			}
+		} else if strings.HasSuffix(forceUnzipPath, ".whl") {
+			// not in m.Wheels, or only its layer entries were read
+			reader, err := zip.OpenReader(forceUnzipPath)
+			if err != nil {
+				return nil, err
+			}
+			for _, wheelF := range reader.File {
+				unzipPaths = append(unzipPaths, wheelF.Name)
+			}
+			err = reader.Close()
+			if err != nil {
+				return nil, err
+			}
+		} else if !contains(forceUnzipPath) {
+			return nil, fmt.Errorf("force_unzip path %s does not exist", forceUnzipPath)
+		} else {
+			unzipPaths = append(unzipPaths, forceUnzipPath)
+		}
+	}
+	return unzipPaths, nil
+}
+
+type cachedPathsZipWriter struct {
+	writer zip.Writer
+	paths  map[string]bool
+}
+
+func newCachedPathsZipWriter(w io.Writer) *cachedPathsZipWriter {
+	zw := zip.NewWriter(w)
+	return &cachedPathsZipWriter{*zw, make(map[string]bool)}
+}
+
+// Same as zip.Writer: Does not close the underlying writer.
+func (c *cachedPathsZipWriter) Close() error {
+	return c.writer.Close()
+}
+func (c *cachedPathsZipWriter) CreateWithMethod(
+	fileinfo os.FileInfo, name string, method uint16,
+) (io.Writer, error) {
+	var header *zip.FileHeader
+	var err error
+	if fileinfo != nil {
+		header, err = zip.FileInfoHeader(fileinfo)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		header = &zip.FileHeader{}
+	}
+	header.Name = name
+	header.Method = method
+	out, err := c.writer.CreateHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	// only append the path if we got "success"
+	c.paths[name] = true
+	return out, nil
+}
+
+// Returns the paths written to this zip so far.
+func (c *cachedPathsZipWriter) Paths() []string {
+	out := []string{}
+	for path := range c.paths {
+		out = append(out, path)
+	}
+	// ensure deterministic output
+	sort.Strings(out)
+	return out
+}
+
+func (c *cachedPathsZipWriter) Contains(path string) bool {
+	return c.paths[path]
+}
+
+// Copies f without decompressing it. The entry keeps f's name and header.
+func (c *cachedPathsZipWriter) Copy(f *zip.File) error {
+	err := c.writer.Copy(f)
+	if err != nil {
+		return err
+	}
+	c.paths[f.Name] = true
+	return nil
+}
+
+// Writes the zip, or another output format, described by zipManifest to outputPath. Returns an
+// *Error if it cannot be built, and removes the partially written zip. hooks may be nil.
+func Pack(zipManifest *Manifest, outputPath string, hooks *Hooks) error {
+	if zipManifest.Layer {
+		if len(zipManifest.Sources) > 0 || len(zipManifest.Layers) > 0 {
+			return invalidManifestf("a layer can only contain Wheels")
+		}
+		err := writeLayer(zipManifest.Wheels, outputPath)
+		if err != nil {
+			os.Remove(outputPath)
+			return ioFailed(err)
+		}
+		return nil
+	}
+	signingKey, err := loadSigningKey(zipManifest)
+	if err != nil {
+		return invalidManifest(err)
+	}
+
+	// other formats are converted from a zip without the #! line
+	zipOutputPath := outputPath
+	unpacked := isUnpackedFormat(zipManifest.OutputFormat)
+	if unpacked {
+		zipOutputPath = outputPath + ".zip.tmp"
+		defer os.Remove(zipOutputPath)
+	}
+	outFile, err := os.OpenFile(zipOutputPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return ioFailed(err)
+	}
+	err = writeZip(zipManifest, outFile, sbomName(zipManifest, outputPath), signingKey, hooks)
+	closeErr := outFile.Close()
+	if err == nil && closeErr != nil {
+		err = ioFailed(closeErr)
+	}
+	if err == nil && signingKey != nil {
+		// only zips are signed, so this is the #! line
+		err = signZipFile(zipOutputPath, []byte("#!"+zipManifest.InterpreterPath+"\n"), signingKey)
+		if err != nil {
+			err = ioFailed(err)
+		}
+	}
+	if err == nil && unpacked {
+		err = writeOutputFormat(zipManifest, zipOutputPath, outputPath)
+		if err != nil {
+			err = ioFailed(err)
+		}
+	}
+	if err != nil {
+		os.Remove(zipOutputPath)
+		return err
+	}
+	return nil
+}
+
+// Writes the zip described by zipManifest to w, after the #! line unless OutputFormat converts
+// it. name is the zip's name in the bill of materials; signingKey is only used to find the
+// keys the zip trusts.
+func writeZip(
+	zipManifest *Manifest, w io.Writer, name string, signingKey ed25519.PrivateKey, hooks *Hooks,
+) error {
+	// without an entry point the first source runs, and the files of a directory are not an
+	// obvious choice
+	if zipManifest.EntryPoint == "" && !zipManifest.Interpreter && len(zipManifest.EntryPoints) == 0 &&
+		len(zipManifest.PytestTests) == 0 && len(zipManifest.Sources) > 0 {
+		stat, err := os.Stat(zipManifest.Sources[0].Src)
+		if err == nil && stat.IsDir() {
+			return invalidManifestf(
+				"the first source %s is a directory: set EntryPoint to the script or module to run",
+				zipManifest.Sources[0].Src)
+		}
+	}
+	var err error
+	zipManifest.Sources, err = expandSources(zipManifest.Sources, zipManifest.SourceSymlinks)
+	if err != nil {
+		return invalidManifest(err)
+	}
+
+	if len(zipManifest.Sources) == 0 && zipManifest.EntryPoint == "" && !zipManifest.Interpreter &&
+		len(zipManifest.EntryPoints) == 0 {
+		return invalidManifestf(
+			"one of Sources, EntryPoint or EntryPoints cannot be empty or Interpreter must be true")
+	}
+	mainOptions := 0
+	for _, isSet := range []bool{zipManifest.EntryPoint != "", zipManifest.Interpreter,
+		len(zipManifest.EntryPoints) > 0, len(zipManifest.PytestTests) > 0} {
+		if isSet {
+			mainOptions++
+		}
+	}
+	if mainOptions > 1 {
+		return invalidManifestf(
+			"only one of EntryPoint OR EntryPoints OR Interpreter OR PytestTests can be set")
+	}
+	if zipManifest.EntryPoint != "" {
+		err = validateModuleEntryPoint(zipManifest.EntryPoint)
+		if err != nil {
+			return invalidManifest(err)
+		}
+	}
+	err = zipManifest.SysPath.validate()
+	if err == nil {
+		err = validateStartup(zipManifest)
+	}
+	if err != nil {
+		return invalidManifest(err)
+	}
+	if len(zipManifest.EntryPoints) > 0 {
+		err = validateCommands(zipManifest.EntryPoints, zipManifest.Sources)
+		if err != nil {
+			return invalidManifest(err)
+		}
+	}
+	if len(zipManifest.PytestTests) > 0 {
+		err = validatePytestTests(zipManifest)
+		if err != nil {
+			return invalidManifest(err)
+		}
+	}
+	err = validateOutputFormat(zipManifest)
+	if err != nil {
+		return invalidManifest(err)
+	}
+	err = validateLicenseOptions(zipManifest)
+	if err != nil {
+		return invalidManifest(err)
+	}
+	switch zipManifest.RequiresPythonCheck {
+	case checkOff, checkWarn, checkError:
+	default:
+		return invalidManifestf("invalid requires_python_check: %#v",
+			zipManifest.RequiresPythonCheck)
+	}
+	var trustedKeys []ed25519.PublicKey
+	if zipManifest.SignatureCheck != signatureCheckOff {
+		trustedKeys, err = trustedPublicKeys(zipManifest, signingKey)
+		if err != nil {
+			return invalidManifest(err)
+		}
+	}
+	if zipManifest.TreeShake && zipManifest.Interpreter {
+		return invalidManifestf("tree_shake cannot be used with Interpreter")
+	}
+	if zipManifest.InterpreterPath == "" {
+		zipManifest.InterpreterPath = DefaultInterpreterLine
+	}
+	if strings.ContainsAny(zipManifest.InterpreterPath, "#!\n") {
+		return invalidManifestf("invalid InterpreterPath: %#v", zipManifest.InterpreterPath)
+	}
+	for _, sourceMeta := range zipManifest.Sources {
+		if isReservedPath(sourceMeta.Dst) {
+			return invalidManifestf("reserved destination name: %s", sourceMeta.Dst)
+		}
+		if sourceMeta.Dst == "" || sourceMeta.Dst[0] == '/' || strings.Contains(sourceMeta.Dst, "..") {
+			return invalidManifestf("invalid dst: %s", sourceMeta.Dst)
+		}
+	}
+
+	// scanners for first-party sources and for wheels
+	sourceScanners := []sourceScanner{}
+	wheelScanners := []sourceScanner{}
+	var zipSafety *zipSafetyScanner
+	switch zipManifest.ZipSafetyCheck {
+	case checkOff:
+	case checkWarn, checkError, zipSafetyUnzip:
+		zipSafety = newZipSafetyScanner(zipManifest.ZipSafetyIgnore)
+		sourceScanners = append(sourceScanners, zipSafety)
+		wheelScanners = append(wheelScanners, zipSafety)
+	default:
+		return invalidManifestf("invalid zip_safety_check: %#v", zipManifest.ZipSafetyCheck)
+	}
+	var imports *importChecker
+	switch zipManifest.ImportCheck {
+	case checkOff:
+	case checkWarn, checkError:
+		imports = newImportChecker(zipManifest.targetPythonVersion(), zipManifest.ImportCheckAllow)
+		sourceScanners = append(sourceScanners, imports)
+	default:
+		return invalidManifestf("invalid import_check: %#v", zipManifest.ImportCheck)
+	}
+
+	var coverage *coverageCollector
+	if zipManifest.Coverage || zipManifest.CoverageManifest != "" {
+		coverage = newCoverageCollector(zipManifest.PytestTests)
+		sourceScanners = append(sourceScanners, coverage)
+	}
+
+	// each wheel's central directory is only read here
+	workers := packWorkers()
+	layers, err := openLayers(zipManifest.Layers)
+	if err != nil {
+		return ioFailed(err)
+	}
+	defer layers.Close()
+	wheels, err := openWheels(zipManifest.Wheels, layers, workers)
+	if err != nil {
+		return ioFailed(err)
+	}
+	defer closeWheels(wheels)
+	wheels, err = selectDistributions(wheels, zipManifest.PreferredWheels)
+	if err != nil {
+		return invalidManifest(err)
+	}
+	zipBuildInfo, err := newBuildInfo(zipManifest, wheels)
+	if err != nil {
+		return ioFailed(err)
+	}
+
+	var requiresPython map[string]string
+	if zipManifest.RequiresPythonCheck != checkOff {
+		target := zipManifest.targetPythonVersion()
+		var incompatible []string
+		requiresPython, incompatible, err = checkRequiresPython(wheels, target)
+		if err != nil {
+			return ioFailed(err)
+		}
+		for _, description := range incompatible {
+			hooks.warnf("not compatible with Python %s: %s", target, description)
+		}
+		if zipManifest.RequiresPythonCheck == checkError && len(incompatible) > 0 {
+			return checkFailedf(
+				"wheels are not compatible with Python %s; change them or python_version", target)
+		}
+	}
+
+	var licenses []*wheelLicense
+	if zipManifest.SBOM || zipManifest.LicenseCheck != checkOff {
+		licenses, err = readWheelLicenses(wheels)
+		if err != nil {
+			return ioFailed(err)
+		}
+		licenseProblems := 0
+		for _, license := range licenses {
+			if license.Problem != "" && zipManifest.LicenseCheck != checkOff {
+				hooks.warnf("license of %s: %s", license.Wheel, license.Problem)
+				licenseProblems++
+			}
+		}
+		if zipManifest.LicenseCheck == checkError && licenseProblems > 0 {
+			return checkFailedf(
+				"wheels have missing or unknown licenses; review them or set license_check=warn")
+		}
+	}
+
+	dropped := map[string]bool{}
+	// contents tree shaking already read
+	readContents := map[string][]byte{}
+	if zipManifest.TreeShake {
+		shaken, err := treeShakeManifest(zipManifest, wheels)
+		if err != nil {
+			return ioFailed(err)
+		}
+		dropped = shaken.Dropped
+		readContents = shaken.Contents
+		hooks.logf("tree shaking dropped %d files", len(shaken.DroppedPaths))
+		if zipManifest.TreeShakeReport != "" {
+			err = writeTreeShakeReportFile(zipManifest.TreeShakeReport, shaken.DroppedPaths)
+			if err != nil {
+				return ioFailed(err)
+			}
+		}
+	}
+
+	unpacked := isUnpackedFormat(zipManifest.OutputFormat)
+	if !unpacked {
+		_, err = io.WriteString(w, "#!"+zipManifest.InterpreterPath+"\n")
+		if err != nil {
+			return ioFailed(err)
+		}
+	}
+	zipWriter := newCachedPathsZipWriter(w)
+	defer zipWriter.Close()
+	sources := newSourceMap()
+
+	// workers read and encode the entries while they are written in this order
+	jobs := []*packJob{}
+	for _, sourceMeta := range zipManifest.Sources {
+		if dropped[sourceMeta.Dst] {
+			continue
+		}
+		job := &packJob{name: sourceMeta.Dst, srcPath: sourceMeta.Src,
+			linkTarget: sourceMeta.LinkTarget, keepData: needsScan(sourceMeta.Dst, sourceScanners)}
+		if sourceMeta.LinkTarget == "" {
+			job.data = readContents[sourceMeta.Dst]
+		}
+		jobs = append(jobs, job)
+	}
+	for _, wheel := range wheels {
+		for _, wheelF := range wheel.Files {
+			pathWithinOutputZip := wheel.OutputPath(wheelF)
+			if dropped[pathWithinOutputZip] {
+				continue
+			}
+			job := &packJob{name: pathWithinOutputZip, wheelF: wheelF,
+				keepData: needsScan(pathWithinOutputZip, wheelScanners) ||
+					isEntryPointsFile(pathWithinOutputZip),
+				data: readContents[pathWithinOutputZip]}
+			if wheel.FromLayer {
+				job.wheelF = nil
+				job.layerF = wheelF
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	pipeline := newPackPipeline(jobs, workers)
+	// runs before the deferred closeWheels
+	defer pipeline.Close()
+	written := 0
+
+	for _, sourceMeta := range zipManifest.Sources {
+		if dropped[sourceMeta.Dst] {
+			continue
+		}
+		entry, err := pipeline.Next()
+		if err != nil {
+			return ioFailed(err)
+		}
+		err = zipWriter.Copy(entry.file)
+		if err != nil {
+			return ioFailed(err)
+		}
+		written++
+		hooks.progress(written, len(jobs))
+		scanSource(sourceMeta.Dst, entry.data, sourceScanners)
+		sources.AddSource(sourceMeta.Dst, sourceMeta.Src)
+		if coverage != nil {
+			coverage.AddSource(sourceMeta.Dst, sourceMeta.Src)
+		}
+	}
+
+	writer, err := zipWriter.CreateWithMethod(nil, "__main__.py", zipMethod)
+	if err != nil {
+		return ioFailed(err)
+	}
+	args := &mainArgs{
+		EntryPoint:          zipManifest.EntryPoint,
+		Interpreter:         zipManifest.Interpreter,
+		SourceMapTracebacks: zipManifest.SourceMapTracebacks,
+		SubprocessReentry:   zipManifest.SubprocessReentry,
+		SysPath:             newSysPathArgs(&zipManifest.SysPath),
+		Unpacked:            unpacked,
+		Coverage:            zipManifest.Coverage,
+		SignatureCheckError: zipManifest.SignatureCheck == signatureCheckError,
+		RequiresPythonError: zipManifest.RequiresPythonCheck == checkError,
+	}
+	if len(requiresPython) > 0 {
+		args.RequiresPython = pythonStringDict(requiresPython)
+	}
+	if len(trustedKeys) > 0 {
+		encodedKeys := []string{}
+		for _, key := range trustedKeys {
+			encodedKeys = append(encodedKeys, base64.StdEncoding.EncodeToString(key))
+		}
+		args.TrustedKeys = pythonStringList(encodedKeys)
+	}
+	if len(zipManifest.InitModules) > 0 {
+		args.InitModules = pythonStringList(zipManifest.InitModules)
+	}
+	if len(zipManifest.DefaultEnv) > 0 {
+		args.DefaultEnv = pythonStringDict(zipManifest.DefaultEnv)
+	}
+	if len(zipManifest.DefaultArgs) > 0 {
+		args.DefaultArgs = pythonStringList(zipManifest.DefaultArgs)
+	}
+	if len(zipManifest.EntryPoints) > 0 {
+		args.Commands = commandsLiteral(zipManifest.EntryPoints)
+	} else if len(zipManifest.PytestTests) > 0 {
+		args.PytestTests = pythonStringList(zipManifest.PytestTests)
+	} else if zipManifest.EntryPoint == "" && !zipManifest.Interpreter {
+		args.ScriptPath = pythonLiteral(zipManifest.Sources[0].Dst)
+	}
+	err = mainTemplate.Execute(writer, args)
+	if err != nil {
+		return ioFailed(err)
+	}
+
+	// copy the wheels
+	distInfo := map[string]string{}
+	consoleScripts := map[string]string{}
+	for _, wheel := range wheels {
+		wheelIndex := sources.AddWheel(wheel.Path)
+		for _, wheelF := range wheel.Files {
+			pathWithinOutputZip := wheel.OutputPath(wheelF)
+			if dropped[pathWithinOutputZip] {
+				continue
+			}
+			// if wheelF.Name != pathWithinOutputZip {
+			// 	  fmt.Fprintln(os.Stderr, "  pathWithinOutputZip, orig: ", wheelF.Name)
+			// 	  fmt.Fprintln(os.Stderr, "  pathWithinOutputZip, repl: ", pathWithinOutputZip)
+			// }
+			entry, err := pipeline.Next()
+			if err != nil {
+				return ioFailed(fmt.Errorf("Error copying %s from %s: %s", wheelF.Name, wheel.Path, err))
+			}
+			err = zipWriter.Copy(entry.file)
+			if err != nil {
+				return ioFailed(err)
+			}
+			written++
+			hooks.progress(written, len(jobs))
+			scanSource(pathWithinOutputZip, entry.data, wheelScanners)
+			sources.AddWheelFile(pathWithinOutputZip, wheelIndex)
+			if dir := distInfoDir(pathWithinOutputZip); dir != "" {
+				distInfo[distInfoProjectName(dir)] = dir
+			}
+			if isEntryPointsFile(pathWithinOutputZip) {
+				scripts, err := parseConsoleScripts(bytes.NewReader(entry.data))
+				if err != nil {
+					return ioFailed(err)
+				}
+				for name, entryPoint := range scripts {
+					consoleScripts[name] = entryPoint
+				}
+			}
+		}
+	}
+
+	for _, runtimePath := range runtimePaths() {
+		writer, err := zipWriter.CreateWithMethod(nil, runtimePath, zipMethod)
+		if err != nil {
+			return ioFailed(err)
+		}
+		_, err = io.WriteString(writer, runtimeFiles[strings.TrimPrefix(runtimePath, runtimePackage+"/")])
+		if err != nil {
+			return ioFailed(err)
+		}
+	}
+
+	// Add __init__.py for any directories that contain python code and do not contain it
+	// This partially is to match what Bazel's native py_library rules do
+	// It also makes "implicit" namespace packages work with Python2.7, without executing
+	// .pth files
+	dirsWithPython := map[string]bool{}
+	for path := range zipWriter.paths {
+		if isPyFile(path) {
+			dir := filepath.Dir(path)
+			for dir != "." && !dirsWithPython[dir] {
+				dirsWithPython[dir] = true
+				dir = filepath.Dir(dir)
+			}
+		}
+	}
+	createInitPyPaths := []string{}
+	for dirWithPython := range dirsWithPython {
+		initPyPath := dirWithPython + "/__init__.py"
+		if !zipWriter.paths[initPyPath] {
+			createInitPyPaths = append(createInitPyPaths, initPyPath)
+		}
+	}
+	// sort to make output deterministic: avoids unneeded rebuilds if output is exactly the same
+	sort.Strings(createInitPyPaths)
+	for _, initPyPath := range createInitPyPaths {
+		// TODO: Add a verbose log flag? This could be useful for debugging problems
+		// fmt.Printf("warning: creating %s\n", initPyPath)
+		_, err := zipWriter.CreateWithMethod(nil, initPyPath, zipMethod)
+		if err != nil {
+			return ioFailed(err)
+		}
+	}
+
+	if imports != nil {
+		unresolved := imports.Unresolved(zipWriter.Paths())
+		for _, unresolvedImport := range unresolved {
+			hooks.warnf("%s", unresolvedImport)
+		}
+		if len(unresolved) > 0 && zipManifest.ImportCheck == checkError {
+			return checkFailedf(
+				"imports are missing from deps; add them or list them in import_check_allow")
+		}
+	}
+
+	// verify that the unzip paths are sane
+	unzipPaths, err := forceUnzipPaths(zipManifest, wheels, zipWriter.Contains)
+	if err != nil {
+		return invalidManifest(err)
+	}
+
+	if zipSafety != nil && len(zipSafety.Findings()) > 0 {
+		for _, finding := range zipSafety.Findings() {
+			hooks.warnf("possibly not zip safe: %s", finding)
+		}
+		switch zipManifest.ZipSafetyCheck {
+		case checkError:
+			return checkFailedf(
+				"code is not zip safe; set zip_safe=False or add it to zip_safety_ignore")
+		}
+	}
+
+	if zipManifest.ForceAllUnzip {
+		// don't list paths if we are going to unzip all
+		unzipPaths = []string{}
+	} else {
+		unzipPaths = append(unzipPaths, computedUnzipPaths(zipManifest, zipWriter.Paths(), zipSafety)...)
+	}
+
+	// write the zip package metadata for the __main__ script to use
+	// multicall commands can also be run as console scripts
+	for name, entryPoint := range zipManifest.EntryPoints {
+		consoleScripts[name] = entryPoint
+	}
+	zipPackageMetadata := &packageInfo{
+		unzipPaths, zipManifest.ForceAllUnzip, zipBuildInfo, distInfo, consoleScripts,
+		zipManifest.ExtractRoot}
+	writer, err = zipWriter.CreateWithMethod(nil, zipInfoPath, zipMethod)
+	if err != nil {
+		return ioFailed(err)
+	}
+	err = json.NewEncoder(writer).Encode(zipPackageMetadata)
+	if err != nil {
+		return ioFailed(err)
+	}
+
+	// only read by __main__ when it needs to rewrite a path
+	writer, err = zipWriter.CreateWithMethod(nil, sourceMapPath, zipMethod)
+	if err != nil {
+		return ioFailed(err)
+	}
+	err = json.NewEncoder(writer).Encode(sources)
+	if err != nil {
+		return ioFailed(err)
+	}
+
+	if coverage != nil {
+		coverageManifest := coverage.Manifest()
+		if zipManifest.Coverage {
+			writer, err = zipWriter.CreateWithMethod(nil, coverageManifestPath, zipMethod)
+			if err != nil {
+				return ioFailed(err)
+			}
+			err = json.NewEncoder(writer).Encode(coverageManifest)
+			if err != nil {
+				return ioFailed(err)
+			}
+		}
+		if zipManifest.CoverageManifest != "" {
+			err = writeJSONFile(zipManifest.CoverageManifest, coverageManifest)
+			if err != nil {
+				return ioFailed(err)
+			}
+		}
+	}
+
+	if zipManifest.SBOM {
+		sbom := newSPDXDocument(name, licenses)
+		writer, err = zipWriter.CreateWithMethod(nil, sbomPath, zipMethod)
+		if err != nil {
+			return ioFailed(err)
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(sbom)
+		if err != nil {
+			return ioFailed(err)
+		}
+		notices := thirdPartyNotices(licenses)
+		writer, err = zipWriter.CreateWithMethod(nil, noticesPath, zipMethod)
+		if err != nil {
+			return ioFailed(err)
+		}
+		_, err = writer.Write(notices)
+		if err != nil {
+			return ioFailed(err)
+		}
+		if zipManifest.SBOMFile != "" {
+			err = writeJSONFile(zipManifest.SBOMFile, sbom)
+			if err != nil {
+				return ioFailed(err)
+			}
+		}
+		if zipManifest.NoticesFile != "" {
+			err = ioutil.WriteFile(zipManifest.NoticesFile, notices, 0644)
+			if err != nil {
+				return ioFailed(err)
+			}
+		}
+	}
+
+	err = closeWheels(wheels)
+	if err == nil {
+		err = layers.Close()
+	}
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if err != nil {
+		return ioFailed(err)
+	}
+	return nil
+}
+
+var mainTemplate = template.Must(template.New("main").Parse(mainTemplateCode))
+
+const mainTemplateCode = `
+# copy the current state so we can exec the script in it
+clean_globals = dict(globals())
+
+
+import json
+import os
+import sys
+import zipimport
+
+_PY3 = sys.version_info >= (3, 0)
+
+
+{{if .SysPath.InterpreterFlags}}
+_FLAG_ATTRIBUTES = {'-E': 'ignore_environment', '-I': 'isolated', '-s': 'no_user_site'}
+def _reexec_with_flags(flags):
+    # some isolation can only be configured when the interpreter starts: re-execute if needed
+    if sys.version_info < (3, 4) and '-I' in flags:
+        # no isolated mode: use the flags it implies
+        flags = [f for f in flags if f != '-I'] + ['-E', '-s']
+    if all(getattr(sys.flags, _FLAG_ATTRIBUTES[f]) for f in flags):
+        return
+    import subprocess
+    script = sys.argv[0]
+    if not os.path.exists(script):
+        script = os.path.dirname(os.path.abspath(__file__))
+        if isinstance(__loader__, zipimport.zipimporter):
+            script = __loader__.archive
+    args = ([sys.executable] + subprocess._args_from_interpreter_flags() + flags + [script] +
+        sys.argv[1:])
+    sys.stdout.flush()
+    sys.stderr.flush()
+    os.execv(sys.executable, args)
+_reexec_with_flags({{.SysPath.InterpreterFlags}})
+{{end}}
+
+{{if .RequiresPython}}
+import pyz_runtime.requires_python
+pyz_runtime.requires_python.check({{.RequiresPython}},
+    {{if .RequiresPythonError}}True{{else}}False{{end}})
+{{end}}
+_SYSTEM_PATH_MARKERS = {{.SysPath.Markers}}
+_ALLOWED_PATHS = [p.rstrip('/') for p in {{.SysPath.AllowPaths}}]
+_user_site = None
+{{if .SysPath.RemoveUserSite}}
+import site
+if hasattr(site, 'getusersitepackages'):
+    _user_site = site.getusersitepackages()
+{{end}}
+def is_site_packages_path(path):
+    '''Returns True if path belongs to the host Python installation. Python on Mac OS X ships
+    with wacky stuff in Extras, like an out of date version of six. We don't want our zips to
+    find those files: they should bundle anything they need.'''
+    for allowed in _ALLOWED_PATHS:
+        if path == allowed or path.startswith(allowed + '/'):
+            return False
+    if _user_site is not None and path.startswith(_user_site):
+        return True
+    for marker in _SYSTEM_PATH_MARKERS:
+        if marker in path:
+            return True
+    return False
+
+removed_paths = [p for p in sys.path if is_site_packages_path(p)]
+sys.path = [p for p in sys.path if not is_site_packages_path(p)]
+
+# filter these paths from any modules: in particular, these could be namespace packages
+# from .pth files that the site module executed
+remove_modules = set()
+for name, module in sys.modules.items():
+    paths = getattr(module, '__path__', None)
+    if paths is not None:
+        module.__path__ = [p for p in paths if not is_site_packages_path(p)]
+        if len(module.__path__) == 0:
+            remove_modules.add(name)
+    file_path = getattr(module, '__file__', '')
+    if is_site_packages_path(file_path):
+        remove_modules.add(name)
+for name in remove_modules:
+    del sys.modules[name]
+{{if .TrustedKeys}}
+if isinstance(__loader__, zipimport.zipimporter):
+    import pyz_runtime.signature
+    pyz_runtime.signature.check(__loader__.archive, {{.TrustedKeys}},
+        {{if .SignatureCheckError}}True{{else}}False{{end}})
+{{end}}
+{{if ne .SysPath.AllowDistributions "[]"}}
+
+import pyz_runtime.isolation
+pyz_runtime.isolation.allow_distributions(removed_paths, {{.SysPath.AllowDistributions}})
+{{end}}
+
+
+def _get_package_path(path):
+    if not isinstance(__loader__, zipimport.zipimporter):
+        # when executed from an unpacked directory, get_data is relative to the current dir
+        # we want it to be relative to the root of our packages (relative to __main__.py)
+        path = os.path.join(os.path.dirname(__file__), path)
+    return path
+
+
+def _load_data(path):
+    data = __loader__.get_data(path)
+    if _PY3:
+        return data.decode()
+    return data
+
+
+def _get_package_data(path):
+    path = _get_package_path(path)
+    return _load_data(path)
+
+
+def _read_package_info():
+    info_bytes = _get_package_data('` + zipInfoPath + `')
+    return json.loads(info_bytes)
+
+
+{{if not .Unpacked}}
+__NAMESPACE_LINE = "__path__ = __import__('__namespace_hack__').extend_path_zip(__path__, __name__)\n"
+def _copy_as_namespace(tempdir, unzipped_dir):
+    '''Copies __init__.py from unzipped_dir, adding a namespace package line if needed.'''
+
+    init_path = os.path.join(unzipped_dir, '__init__.py')
+    output_path = os.path.join(tempdir, init_path)
+    with open(os.path.join(tempdir, unzipped_dir, '__init__.py'), 'w') as f:
+        try:
+            data = _load_data(init_path)
+            # from future imports must be the first statement in __init__.py: insert our line after
+            # this must be after any comments and doc comments
+            # TODO: maybe we should do this at "build" time?
+            lines = data.splitlines()
+            last_future_line = -1
+            for i, line in enumerate(lines):
+                if '__future__' in line:
+                    last_future_line = i
+            # if we don't find future, must insert after any "coding" directive, which must be
+            # in the first two lines. Just insert after the first two lines of comments
+            if last_future_line == -1:
+                if len(lines) > 0 and lines[0].startswith('#'):
+                    last_future_line = 0
+                if len(lines) > 1 and lines[1].startswith('#'):
+                    last_future_line = 1
+            lines.insert(last_future_line+1, __NAMESPACE_LINE)
+            f.write('\n'.join(lines))
+        except IOError:
+            # ziploader.get_data raises this if the file does not exist
+            f.write(__NAMESPACE_LINE)
+{{end}}
+
+package_info = _read_package_info()
+if len(sys.argv) > 1 and sys.argv[1] == '--pyz-info':
+    # reserved flag: print how this zip was built
+    print(json.dumps(package_info['build_info'], indent=2, sort_keys=True))
+    sys.exit(0)
+{{if .DefaultEnv}}
+def _set_default_env(default_env):
+    # the environment the process was started with takes precedence
+    for key, value in default_env.items():
+        if key not in os.environ:
+            os.environ[key] = value
+            if key == 'TZ' and hasattr(time, 'tzset'):
+                time.tzset()
+import time
+_set_default_env({{.DefaultEnv}})
+{{end}}
+tempdir = None
+{{if not .Unpacked}}
+if isinstance(__loader__, zipimport.zipimporter) and not package_info['force_all_unzip']:
+    # make importlib.metadata and pkg_resources find the packed distributions. pkg_resources
+    # otherwise finds our zip as an egg and can mess with sys.path, which breaks namespace
+    # packages like google.cloud.datastore and gunicorn
+    import pyz_runtime.metadata
+    pyz_runtime.metadata.install(package_info['dist_info'])
+
+need_unzip = len(package_info['unzip_paths']) > 0 or package_info['force_all_unzip']
+if need_unzip and isinstance(__loader__, zipimport.zipimporter):
+    # do not import these modules unless we have to
+    import types
+    import zipfile
+
+    # Extracts zips and preserves original permissions from Unix systems
+    # https://bugs.python.org/issue15795
+    # https://stackoverflow.com/questions/39296101/python-zipfile-removes-execute-permissions-from-binaries
+    class PreservePermissionsZipFile(zipfile.ZipFile):
+        def extract(self, member, path=None, pwd=None):
+            extracted_path = super(PreservePermissionsZipFile, self).extract(member, path, pwd)
+            info = self.getinfo(member)
+            original_attr = info.external_attr >> 16
+            if original_attr != 0:
+                os.chmod(extracted_path, original_attr)
+            return extracted_path
+
+    # create the dir under PYZ_TMPDIR or the manifest's extract_root, and remove it at exit or
+    # on signals. It is shared with pyz_runtime.resources, which extracts files on demand
+    import pyz_runtime._zip
+    tempdir = pyz_runtime._zip.extraction_dir()
+    sys.path.insert(0, tempdir)
+
+    package_zip = PreservePermissionsZipFile(__loader__.archive)
+    files_to_unzip = package_info['unzip_paths']
+    if package_info['force_all_unzip']:
+        files_to_unzip = None
+    package_zip.extractall(path=tempdir, members=files_to_unzip)
+
+    # pkgutil.extend_path does not add zips to __path__; hack a function that will
+    # register it as a module so it can be referenced from random __init__.py
+    namespace_hack_module = types.ModuleType('__namespace_hack__')
+    sys.modules[namespace_hack_module.__name__] = namespace_hack_module
+    _path_to_extend=[tempdir, __loader__.archive]
+    def extend_path_zip(paths, name):
+        name_path = name.replace('.', '/')
+
+        do_not_add_paths = set()
+        for current_path in paths:
+            for extend_path in _path_to_extend:
+                if current_path.startswith(extend_path):
+                    do_not_add_paths.add(extend_path)
+        for extend_path in _path_to_extend:
+            if extend_path not in do_not_add_paths:
+                paths.append(extend_path + '/' + name_path)
+        return paths
+    namespace_hack_module.extend_path_zip = extend_path_zip
+
+    # generate the set of directories that contain Python packages
+    py_dirs = set()
+    for zip_path in package_zip.namelist():
+        if zip_path.endswith('.py') or zip_path.endswith('.pyc') or zip_path.endswith('.pyo'):
+            py_dirs.add(os.path.dirname(zip_path))
+
+    # make the unzipped directories namespace packages, all the way to the root
+    # TODO: Should this be pre-processed at build time to avoid duplicate runtime work?
+    inits = set()
+    for unzipped_path in package_info['unzip_paths']:
+        unzipped_dir = os.path.dirname(unzipped_path)
+        while unzipped_dir != '' and unzipped_dir not in inits:
+            # only create inits if the dir contains python code
+            if unzipped_dir in py_dirs:
+                inits.add(unzipped_dir)
+                _copy_as_namespace(tempdir, unzipped_dir)
+            unzipped_dir = os.path.dirname(unzipped_dir)
+{{end}}
+
+{{if .SourceMapTracebacks}}
+def _install_source_map_hooks():
+    '''Rewrites file names in tracebacks and log records to paths in the source workspace.'''
+    import logging
+    import re
+
+    roots = [os.path.normpath(os.path.abspath(os.path.dirname(__file__)))]
+    if isinstance(__loader__, zipimport.zipimporter):
+        roots.append(os.path.normpath(os.path.abspath(__loader__.archive)))
+    if tempdir is not None:
+        roots.append(os.path.normpath(tempdir))
+    # loaded lazily: only needed when something is printed
+    source_map = []
+
+    def zip_relative_path(filename):
+        normalized = os.path.normpath(os.path.abspath(filename))
+        for root in roots:
+            if normalized.startswith(root + '/'):
+                return root, normalized[len(root)+1:]
+        return None, None
+
+    def workspace_path(filename):
+        _, zip_path = zip_relative_path(filename)
+        if zip_path is None:
+            return filename
+        if len(source_map) == 0:
+            source_map.append(json.loads(_get_package_data('` + sourceMapPath + `')))
+        if zip_path in source_map[0]['sources']:
+            return source_map[0]['sources'][zip_path]
+        wheel_index = source_map[0]['wheels'].get(zip_path)
+        if wheel_index is not None:
+            return source_map[0]['distributions'][wheel_index] + '/' + zip_path
+        return filename
+
+    def cache_source_lines(exc_value, tb):
+        '''Loads source lines for files in the zip: linecache finds the wrong source for scripts
+        executed by __main__, since they share its loader.'''
+        import linecache
+        seen = set()
+        while exc_value is not None or tb is not None:
+            while tb is not None:
+                filename = tb.tb_frame.f_code.co_filename
+                root, zip_path = zip_relative_path(filename)
+                if zip_path is not None and root != tempdir and filename not in linecache.cache:
+                    try:
+                        data = _get_package_data(zip_path)
+                        linecache.cache[filename] = (
+                            len(data), None, data.splitlines(True), filename)
+                    except IOError:
+                        pass
+                tb = tb.tb_next
+            # follow chained exceptions
+            seen.add(id(exc_value))
+            exc_value = getattr(exc_value, '__cause__', None) or getattr(
+                exc_value, '__context__', None)
+            if id(exc_value) in seen:
+                break
+            tb = getattr(exc_value, '__traceback__', None)
+
+    file_re = re.compile(r'File "([^"]+)"')
+    def rewrite_text(text):
+        return file_re.sub(lambda m: 'File "%s"' % workspace_path(m.group(1)), text)
+
+    original_excepthook = sys.excepthook
+    def excepthook(exc_type, exc_value, tb):
+        try:
+            import traceback
+            cache_source_lines(exc_value, tb)
+            text = ''.join(traceback.format_exception(exc_type, exc_value, tb))
+            sys.stderr.write(rewrite_text(text))
+        except Exception:
+            original_excepthook(exc_type, exc_value, tb)
+    sys.excepthook = excepthook
+
+    class SourceMapFilter(logging.Filter):
+        def filter(self, record):
+            record.pathname = workspace_path(record.pathname)
+            if record.exc_info and not record.exc_text:
+                cache_source_lines(record.exc_info[1], record.exc_info[2])
+                record.exc_text = rewrite_text(
+                    logging.Formatter().formatException(record.exc_info))
+            return True
+
+    # filters on loggers do not apply to records from child loggers: apply it to all records
+    source_map_filter = SourceMapFilter()
+    make_record = logging.Logger.makeRecord
+    def make_rewritten_record(self, *args, **kwargs):
+        record = make_record(self, *args, **kwargs)
+        source_map_filter.filter(record)
+        return record
+    logging.Logger.makeRecord = make_rewritten_record
+_install_source_map_hooks()
+{{end}}
+
+def _run_script(script_path):
+    # load the original script and evaluate it inside this zip
+    is_script_unzipped = script_path in package_info['unzip_paths'] or package_info['force_all_unzip']
+    if tempdir is not None and is_script_unzipped:
+        script_path = tempdir + '/' + script_path
+        script_data = open(script_path).read()
+    else:
+        script_data = _get_package_data(script_path)
+
+        # assumes that __main__ is in the root dir either of a zip or a real dir
+        pythonroot = os.path.dirname(__file__)
+        script_path = os.path.join(pythonroot, script_path)
+
+    clean_globals['__file__'] = script_path
+
+    ast = compile(script_data, script_path, 'exec', flags=0, dont_inherit=1)
+
+    # execute the script with a clean state (no imports or variables)
+    exec(ast, clean_globals)
+
+def _run_entry_point(entry_point):
+    if ':' not in entry_point:
+        import runpy
+        runpy.run_module(entry_point, run_name='__main__')
+        return
+
+    # module:function: call it like a console_scripts wrapper
+    import importlib
+    module_name, attrs = entry_point.split(':', 1)
+    target = importlib.import_module(module_name)
+    for attr in attrs.split('.'):
+        target = getattr(target, attr)
+    sys.exit(target())
+
+_PYTHON_USAGE = 'usage: %s [option] ... [-c cmd | -m mod | file | -] [arg] ...\n'
+_PYTHON_HELP = """Options:
+-B     : don't write .pyc files on import
+-c cmd : program passed in as string (terminates option list)
+-E     : ignore PYTHONPATH
+-h     : print this help message and exit (also -? or --help)
+-i     : inspect interactively after running script
+-m mod : run library module as a script (terminates option list)
+-q     : don't print version and copyright messages on interactive startup
+-u     : force the stdout and stderr streams to be unbuffered
+-V     : print the Python version number and exit (also --version)
+-W arg : warning control; arg is action:message:category:module:lineno
+-x     : skip first line of source
+file   : program read from script file
+-      : program read from stdin (default; interactive mode if a tty)
+arg ...: arguments passed to program in sys.argv[1:]
+Other interpreter options are accepted and ignored.
+"""
+
+def _python_usage_error(program, message):
+    sys.stderr.write(message + '\n')
+    sys.stderr.write(_PYTHON_USAGE % program)
+    sys.stderr.write("Try ` + "`" + `python -h' for more information.\n")
+    sys.exit(2)
+
+def _unbuffered(stream):
+    stream.flush()
+    if sys.version_info[0] == 2:
+        return os.fdopen(os.dup(stream.fileno()), 'w', 0)
+    import io
+    raw = io.FileIO(stream.fileno(), 'w', closefd=False)
+    return io.TextIOWrapper(raw, encoding=stream.encoding, errors=stream.errors,
+        write_through=True)
+
+def _skip_first_line(source):
+    # keep the newline so line numbers are the same
+    newline = source.find(b'\n')
+    if newline < 0:
+        return b''
+    return source[newline:]
+
+def _interact(namespace, banner):
+    try:
+        # line editing and history, like the real interpreter
+        import readline
+    except ImportError:
+        pass
+    import code
+    console = code.InteractiveConsole(namespace)
+    if sys.version_info >= (3, 6):
+        console.interact(banner, exitmsg='')
+    else:
+        console.interact(banner)
+
+def _run_python(args):
+    # emulates the python command line, e.g. "python -c 'import x'" or "python -m pytest".
+    # Options that only affect interpreter startup are accepted and ignored.
+    program = sys.argv[0]
+    inspect = False
+    quiet = False
+    ignore_environment = False
+    skip_first_line = False
+    command = None
+    module = None
+    while (len(args) > 0 and args[0].startswith('-') and args[0] != '-' and
+            command is None and module is None):
+        option = args.pop(0)
+        if option == '--':
+            break
+        if option in ('-V', '--version', '-VV'):
+            version = sys.version if option == '-VV' else sys.version.split()[0]
+            # Python 2 prints the version to stderr
+            out = sys.stdout if sys.version_info[0] >= 3 else sys.stderr
+            out.write('Python %s\n' % version)
+            sys.exit(0)
+        if option in ('-h', '-?', '--help'):
+            sys.stdout.write(_PYTHON_USAGE % program)
+            sys.stdout.write(_PYTHON_HELP)
+            sys.exit(0)
+        if option.startswith('--'):
+            _python_usage_error(program, 'unknown option ' + option)
+        i = 1
+        while i < len(option):
+            flag = option[i]
+            i += 1
+            if flag in 'cmQWX':
+                # the value is the rest of this argument or the next argument
+                value = option[i:]
+                i = len(option)
+                if value == '':
+                    if len(args) == 0:
+                        _python_usage_error(program, 'Argument expected for the -%s option' % flag)
+                    value = args.pop(0)
+                if flag == 'c':
+                    command = value
+                elif flag == 'm':
+                    module = value
+                elif flag == 'W':
+                    import warnings
+                    sys.warnoptions.append(value)
+                    if hasattr(warnings, '_processoptions'):
+                        warnings._processoptions([value])
+            elif flag == 'i':
+                inspect = True
+            elif flag == 'u':
+                sys.stdout = _unbuffered(sys.stdout)
+                sys.stderr = _unbuffered(sys.stderr)
+            elif flag == 'E':
+                ignore_environment = True
+            elif flag == 'B':
+                sys.dont_write_bytecode = True
+            elif flag == 'q':
+                quiet = True
+            elif flag == 'x':
+                skip_first_line = True
+            elif flag not in '3bdIORsStv':
+                _python_usage_error(program, 'Unknown option: -' + flag)
+
+    if ignore_environment and os.environ.get('PYTHONPATH'):
+        # the interpreter already added PYTHONPATH: remove it, but keep this zip
+        pyz_paths = [os.path.abspath(os.path.dirname(__file__)), tempdir]
+        environment_paths = [os.path.abspath(p)
+            for p in os.environ['PYTHONPATH'].split(os.pathsep) if p != '']
+        sys.path[:] = [p for p in sys.path
+            if p in pyz_paths or os.path.abspath(p) not in environment_paths]
+
+    # run the program in the same way as the interpreter
+    namespace = clean_globals
+    namespace.pop('__file__', None)
+    source = None
+    if module is not None:
+        sys.argv = ['-m'] + args
+        sys.path.insert(0, os.getcwd())
+    elif command is not None:
+        sys.argv = ['-c'] + args
+        sys.path.insert(0, '')
+        source = command
+        source_path = '<string>'
+    elif len(args) == 0 or args[0] == '-':
+        sys.argv = args or ['']
+        sys.path.insert(0, '')
+        if len(args) == 0 and sys.stdin.isatty():
+            banner = ('Python %s on %s\n' % (sys.version, sys.platform) +
+                'Type "help", "copyright", "credits" or "license" for more information.')
+            _interact(namespace, '' if quiet else banner)
+            return
+        # read bytes so compile() uses the source encoding declaration
+        source = getattr(sys.stdin, 'buffer', sys.stdin).read()
+        if skip_first_line:
+            source = _skip_first_line(source)
+        source_path = '<stdin>'
+    else:
+        sys.argv = args
+        script_path = args[0]
+        sys.path.insert(0, os.path.dirname(os.path.abspath(script_path)))
+        import zipfile
+        if not os.path.isdir(script_path) and not zipfile.is_zipfile(script_path):
+            try:
+                with open(script_path, 'rb') as f:
+                    source = f.read()
+            except IOError as e:
+                sys.stderr.write("%s: can't open file '%s': [Errno %d] %s\n" % (
+                    program, script_path, e.errno, e.strerror))
+                sys.exit(2)
+            if skip_first_line:
+                source = _skip_first_line(source)
+            namespace['__file__'] = script_path
+            source_path = script_path
+
+    try:
+        if module is not None:
+            import runpy
+            runpy._run_module_as_main(module)
+            namespace = sys.modules['__main__'].__dict__
+        elif source is None:
+            # a directory or zip containing __main__.py
+            import runpy
+            sys.path[0] = sys.argv[0]
+            namespace = runpy.run_path(sys.argv[0], run_name='__main__')
+        else:
+            exec(compile(source, source_path, 'exec', 0, 1), namespace)
+    except BaseException:
+        exc_type, exc_value, exc_traceback = sys.exc_info()
+        if not inspect and issubclass(exc_type, (SystemExit, KeyboardInterrupt)):
+            raise
+        # print the traceback without this function like the interpreter, then exit with 1
+        exc_traceback = exc_traceback.tb_next
+        if hasattr(exc_value, 'with_traceback'):
+            exc_value = exc_value.with_traceback(exc_traceback)
+        sys.excepthook(exc_type, exc_value, exc_traceback)
+        if not inspect:
+            sys.exit(1)
+    if inspect:
+        _interact(namespace, '')
+
+{{if .SubprocessReentry}}
+import pyz_runtime.reentry
+pyz_runtime.reentry.install(package_info['console_scripts'])
+{{end}}
+{{if .Coverage}}
+if os.environ.get('COVERAGE_DIR'):
+    # set by bazel coverage: trace first-party code and write LCOV there at exit
+    import pyz_runtime.coverage
+    pyz_runtime.coverage.start(os.environ['COVERAGE_DIR'], tempdir)
+{{end}}
+{{if .InitModules}}
+def _run_init_modules(init_modules):
+    # runs before the entry point, e.g. for gevent.monkey:patch_all or logging configuration
+    import importlib
+    for init_module in init_modules:
+        module_name, _, attrs = init_module.partition(':')
+        target = importlib.import_module(module_name)
+        if attrs != '':
+            for attr in attrs.split('.'):
+                target = getattr(target, attr)
+            target()
+_run_init_modules({{.InitModules}})
+{{end}}
+if len(sys.argv) > 2 and sys.argv[1] == '--pyz-run':
+    # reserved flag used by pyz_runtime.reentry: run a console script or command
+    _entry_point = package_info['console_scripts'].get(sys.argv[2])
+    if _entry_point is None:
+        sys.stderr.write('error: unknown console script: %s\n' % sys.argv[2])
+        sys.exit(2)
+    sys.argv = sys.argv[2:]
+    if _entry_point.endswith('.py') or '/' in _entry_point:
+        _run_script(_entry_point)
+    else:
+        _run_entry_point(_entry_point)
+    sys.exit(0)
+if len(sys.argv) > 1 and sys.argv[1] == '--pyz-python':
+    # reserved flag used by pyz_runtime.reentry: run like the python command
+    _run_python(sys.argv[2:])
+    sys.exit(0)
+
+{{if .Commands}}
+_COMMANDS = {{.Commands}}
+
+def _usage(message):
+    sys.stderr.write(message + '\n')
+    sys.stderr.write('usage: %s COMMAND [ARGS...]\n\ncommands:\n' % os.path.basename(sys.argv[0]))
+    for name in sorted(_COMMANDS):
+        sys.stderr.write('  %s\n' % name)
+    sys.exit(2)
+
+def _select_command():
+    # installed as a symlink or copy named after the command
+    invoked_name = os.path.basename(sys.argv[0])
+    for name in (invoked_name, os.path.splitext(invoked_name)[0]):
+        if name in _COMMANDS:
+            return name
+    if len(sys.argv) == 1:
+        _usage('error: missing command')
+    if sys.argv[1] not in _COMMANDS:
+        _usage('error: unknown command: ' + sys.argv[1])
+    # subcommand: run it as if it was invoked directly
+    name = sys.argv[1]
+    sys.argv = [name] + sys.argv[2:]
+    return name
+
+_command_kind, _command_entry_point = _COMMANDS[_select_command()]
+{{end}}
+{{if .DefaultArgs}}
+# default arguments go before the arguments the zip was run with
+sys.argv[1:1] = {{.DefaultArgs}}
+{{end}}
+{{if .Interpreter }}
+_run_python(sys.argv[1:])
+{{else if .Commands}}
+if _command_kind == 'script':
+    _run_script(_command_entry_point)
+else:
+    _run_entry_point(_command_entry_point)
+{{else if .PytestTests}}
+import pyz_runtime.testing
+# the tests were extracted, unless this is an unpacked directory
+pyz_runtime.testing.main({{.PytestTests}},
+    tempdir if tempdir is not None else os.path.dirname(os.path.abspath(__file__)))
+{{else if .ScriptPath}}
+_run_script({{.ScriptPath}})
+{{else}}
+_run_entry_point('{{.EntryPoint}}')
+{{end}}
+`
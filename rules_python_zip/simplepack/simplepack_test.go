@@ -0,0 +1,190 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"testing"
+)
+
+func TestFilterUnzipPaths(t *testing.T) {
+	paths := []string{
+		".libs/libffi-45372312.so.6.0.4",
+		"resource.txt",
+		"scipy/.dylibs/example.py",
+		"scipy/.dylibs/libgfortran.3.dylib",
+		"scipy/.so.dir/foo.py",
+		"scipy/_lib/_ccallback.py",
+		"scipy/_lib/_ccallback_c.so",
+		"scipy/_lib/foo.dylib.py",
+	}
+	expected := []string{
+		".libs/libffi-45372312.so.6.0.4",
+		"scipy/.dylibs/libgfortran.3.dylib",
+		"scipy/_lib/_ccallback_c.so",
+	}
+	out := filterUnzipPaths(paths)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("filterUnzipPaths(%#v)=%#v; expected %#v", paths, out, expected)
+	}
+
+	// non-python resources in paths that contain native code should be unzipped
+	paths = []string{
+		"nativelib/compiled.pyc",
+		"nativelib/compiled.pyo",
+		"nativelib/file.py",
+		"nativelib/lib.so",
+		"nativelib/resource.txt",
+		"nativelib/subdir/resource.txt",
+		"pythonlib/file.py",
+		"pythonlib/resource.txt",
+		"resource.txt",
+	}
+	expected = []string{
+		"nativelib/lib.so",
+		"nativelib/resource.txt",
+		"nativelib/subdir/resource.txt",
+	}
+	out = filterUnzipPaths(paths)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("filterUnzipPaths(%#v)=%#v; expected %#v", paths, out, expected)
+	}
+
+	// root native libs need special handling to avoid unpacking the universe
+	paths = []string{
+		"lib.so",
+		"resource.txt",
+		"subdir/resource.txt",
+	}
+	expected = []string{
+		"lib.so",
+		"resource.txt",
+	}
+	out = filterUnzipPaths(paths)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("filterUnzipPaths(%#v)=%#v; expected %#v", paths, out, expected)
+	}
+}
+
+func TestZipWriter(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+	zw := newCachedPathsZipWriter(tempFile)
+	createPaths := []string{"aaa.txt", "bbb.txt", "ccc.txt", "zzz.txt"}
+	for _, path := range createPaths {
+		if zw.Contains(path) {
+			t.Error("should not contain path: ", path)
+		}
+		fileInfo, err := tempFile.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = zw.CreateWithMethod(fileInfo, path, zip.Store)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ensure Paths is deterministic
+	paths := zw.Paths()
+	if !reflect.DeepEqual(paths, createPaths) {
+		t.Errorf("paths=%#v != createPaths=%#v", paths, createPaths)
+	}
+
+	for _, path := range createPaths {
+		if !zw.Contains(path) {
+			t.Error("should contain path: ", path)
+		}
+	}
+}
+
+type recordingScanner struct {
+	scanned map[string]string
+}
+
+func (r *recordingScanner) Scan(path string, data []byte) {
+	r.scanned[path] = string(data)
+}
+
+func TestScanSource(t *testing.T) {
+	scanSource("x.py", []byte("data"), nil)
+
+	scanner := &recordingScanner{map[string]string{}}
+	scanners := []sourceScanner{scanner}
+	for _, path := range []string{"a.py", "b.txt"} {
+		scanSource(path, []byte("contents "+path), scanners)
+	}
+	expected := map[string]string{"a.py": "contents a.py"}
+	if !reflect.DeepEqual(scanner.scanned, expected) {
+		t.Errorf("scanned=%#v; expected %#v", scanner.scanned, expected)
+	}
+}
+
+func TestTargetPythonVersion(t *testing.T) {
+	tests := []struct {
+		m        Manifest
+		expected string
+	}{
+		{Manifest{}, "2.7"},
+		{Manifest{InterpreterPath: "/usr/bin/env python3"}, "3"},
+		{Manifest{InterpreterPath: "/usr/local/bin/python3.6 -S"}, "3.6"},
+		{Manifest{InterpreterPath: "/opt/interp"}, "2.7"},
+		{Manifest{InterpreterPath: "/usr/bin/python3", PythonVersion: "2.7"}, "2.7"},
+	}
+	for _, test := range tests {
+		version := test.m.targetPythonVersion()
+		if version != test.expected {
+			t.Errorf("targetPythonVersion(%#v)=%#v; expected %#v", test.m, version, test.expected)
+		}
+	}
+}
+
+func TestForceUnzipPaths(t *testing.T) {
+	six10 := testWheelContents(t, "a/six-1.10.0-py2.py3-none-any.whl", map[string]string{
+		"six.py":                        "",
+		"six-1.10.0.dist-info/METADATA": "Name: six\nVersion: 1.10.0\n",
+	})
+	six11 := testWheelContents(t, "b/six-1.11.0-py2.py3-none-any.whl", map[string]string{
+		"six.py":                        "",
+		"six-1.11.0.dist-info/METADATA": "Name: six\nVersion: 1.11.0\n",
+	})
+	m := &Manifest{
+		Wheels:          []string{six10.Path, six11.Path},
+		PreferredWheels: []string{filepath.Base(six11.Path)},
+		ForceUnzip:      []string{six10.Path, six11.Path, "data/file.txt"},
+	}
+	packed, err := selectDistributions([]*wheelContents{six10, six11}, m.PreferredWheels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contains := func(path string) bool { return path == "data/file.txt" }
+
+	// six10 is not packed: it is not opened again
+	paths, err := forceUnzipPaths(m, packed, contains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	expected := []string{"data/file.txt", "six-1.11.0.dist-info/METADATA", "six.py"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("forceUnzipPaths(%#v)=%#v; expected %#v", m.ForceUnzip, paths, expected)
+	}
+
+	m.ForceUnzip = []string{"data/missing.txt"}
+	_, err = forceUnzipPaths(m, packed, contains)
+	if err == nil || err.Error() != "force_unzip path data/missing.txt does not exist" {
+		t.Errorf("forceUnzipPaths(%#v) error=%v", m.ForceUnzip, err)
+	}
+}
@@ -0,0 +1,125 @@
+package simplepack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Values for Manifest.SourceSymlinks
+const (
+	// Packs the file or directory the symlink points to
+	symlinksFollow = ""
+	// Packs the symlink as a zip symlink entry. The target must be relative and inside the
+	// zip. Only for unpacked output formats: see validateOutputFormat
+	symlinksStore = "store"
+)
+
+// Replaces sources that are directories, like Bazel tree artifacts, with the files they
+// contain. Files are under the directory's Dst, sorted by name within each directory.
+func expandSources(sources []ManifestSource, symlinks string) ([]ManifestSource, error) {
+	switch symlinks {
+	case symlinksFollow, symlinksStore:
+	default:
+		return nil, fmt.Errorf("invalid source_symlinks: %#v", symlinks)
+	}
+
+	expanded := []ManifestSource{}
+	for _, source := range sources {
+		stat, err := os.Stat(source.Src)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			expanded = append(expanded, source)
+			continue
+		}
+		expander := &sourceDirExpander{source.Src, symlinks, map[string]bool{}, nil}
+		err = expander.expand(source.Src, source.Dst)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, expander.sources...)
+	}
+	return expanded, nil
+}
+
+type sourceDirExpander struct {
+	root     string
+	symlinks string
+	// Real paths of the directories being expanded, to detect symlink cycles
+	visiting map[string]bool
+	sources  []ManifestSource
+}
+
+func (e *sourceDirExpander) expand(dir string, dst string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if e.visiting[realDir] {
+		return fmt.Errorf("symlink cycle in source directory %s: %s", e.root, dir)
+	}
+	e.visiting[realDir] = true
+	defer delete(e.visiting, realDir)
+
+	// sorted by name
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		src := filepath.Join(dir, entry.Name())
+		entryDst := path.Join(dst, entry.Name())
+		mode := entry.Mode()
+		if mode&os.ModeSymlink != 0 {
+			if e.symlinks == symlinksStore {
+				target, err := e.storedLinkTarget(src, entryDst, dst)
+				if err != nil {
+					return err
+				}
+				e.sources = append(e.sources, ManifestSource{Src: src, Dst: entryDst, LinkTarget: target})
+				continue
+			}
+			stat, err := os.Stat(src)
+			if err != nil {
+				return fmt.Errorf("source directory %s: broken symlink: %s", e.root, err)
+			}
+			mode = stat.Mode()
+		}
+
+		switch {
+		case mode.IsDir():
+			err = e.expand(src, entryDst)
+			if err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			e.sources = append(e.sources, ManifestSource{Src: src, Dst: entryDst})
+		default:
+			return fmt.Errorf("source directory %s: unsupported file type: %s", e.root, src)
+		}
+	}
+	return nil
+}
+
+// Returns the target of the symlink at src, which is packed as linkDst in directory dir.
+func (e *sourceDirExpander) storedLinkTarget(
+	src string, linkDst string, dir string,
+) (string, error) {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return "", err
+	}
+	target = filepath.ToSlash(target)
+	// must point inside the zip
+	resolved := path.Join(dir, target)
+	if path.IsAbs(target) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("source directory %s: symlink %s points outside the zip: %s",
+			e.root, linkDst, target)
+	}
+	return target, nil
+}
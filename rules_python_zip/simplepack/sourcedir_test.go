@@ -0,0 +1,85 @@
+package simplepack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandSources(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	for _, path := range []string{"gen/pkg/sub/b.py", "gen/pkg/a.py", "gen/pkg.py", "main.py"} {
+		filePath := filepath.Join(tempDir, path)
+		err = os.MkdirAll(filepath.Dir(filePath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filePath, []byte(path), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Symlink("a.py", filepath.Join(tempDir, "gen/pkg/link.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := []ManifestSource{
+		{Src: filepath.Join(tempDir, "main.py"), Dst: "main.py"},
+		{Src: filepath.Join(tempDir, "gen"), Dst: "out"},
+	}
+
+	expanded, err := expandSources(sources, symlinksFollow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ManifestSource{
+		{Src: filepath.Join(tempDir, "main.py"), Dst: "main.py"},
+		{Src: filepath.Join(tempDir, "gen/pkg/a.py"), Dst: "out/pkg/a.py"},
+		{Src: filepath.Join(tempDir, "gen/pkg/link.py"), Dst: "out/pkg/link.py"},
+		{Src: filepath.Join(tempDir, "gen/pkg/sub/b.py"), Dst: "out/pkg/sub/b.py"},
+		{Src: filepath.Join(tempDir, "gen/pkg.py"), Dst: "out/pkg.py"},
+	}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("expandSources()=%#v; expected %#v", expanded, expected)
+	}
+
+	expanded, err = expandSources(sources, symlinksStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected[2].LinkTarget = "a.py"
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("expandSources(store)=%#v; expected %#v", expanded, expected)
+	}
+
+	_, err = expandSources(sources, "copy")
+	if err == nil {
+		t.Error("expandSources() with invalid symlinks should fail")
+	}
+
+	// stored symlinks cannot point outside the zip
+	err = os.Symlink("../../../main.py", filepath.Join(tempDir, "gen/pkg/outside.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expandSources(sources, symlinksStore)
+	if err == nil {
+		t.Error("expandSources(store) with a symlink outside the zip should fail")
+	}
+
+	// following a cycle fails
+	err = os.Symlink("..", filepath.Join(tempDir, "gen/pkg/sub/parent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expandSources(sources, symlinksFollow)
+	if err == nil {
+		t.Error("expandSources() with a symlink cycle should fail")
+	}
+}
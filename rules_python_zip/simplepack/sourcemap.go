@@ -0,0 +1,57 @@
+package simplepack
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const sourceMapPath = "_source_map_.json"
+
+var bazelOutputPrefixRe = regexp.MustCompile(`^bazel-out/[^/]+/(?:bin|genfiles)/`)
+
+// Maps paths in the zip back to where they came from. Stored in the zip as sourceMapPath so
+// __main__.py can rewrite file names in tracebacks.
+type sourceMap struct {
+	// Zip path to workspace-relative source path
+	Sources map[string]string `json:"sources"`
+	// Zip path to an index in Distributions
+	Wheels map[string]int `json:"wheels"`
+	// Wheel distributions as "name-version"
+	Distributions []string `json:"distributions"`
+}
+
+func newSourceMap() *sourceMap {
+	return &sourceMap{map[string]string{}, map[string]int{}, []string{}}
+}
+
+// Returns the workspace-relative path for a manifest Src, which is relative to Bazel's
+// execution root.
+func workspaceRelativePath(src string) string {
+	return bazelOutputPrefixRe.ReplaceAllLiteralString(filepath.ToSlash(src), "")
+}
+
+// Returns the distribution name and version from a wheel file name. See
+// https://www.python.org/dev/peps/pep-0427/#file-name-convention
+func wheelNameVersion(wheelPath string) (string, string) {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(wheelPath), ".whl"), "-")
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (s *sourceMap) AddSource(dst string, src string) {
+	s.Sources[dst] = workspaceRelativePath(src)
+}
+
+// Adds a wheel and returns the index to pass to AddWheelFile.
+func (s *sourceMap) AddWheel(wheelPath string) int {
+	name, version := wheelNameVersion(wheelPath)
+	s.Distributions = append(s.Distributions, name+"-"+version)
+	return len(s.Distributions) - 1
+}
+
+func (s *sourceMap) AddWheelFile(path string, wheelIndex int) {
+	s.Wheels[path] = wheelIndex
+}
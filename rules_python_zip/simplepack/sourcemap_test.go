@@ -0,0 +1,49 @@
+package simplepack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWheelNameVersion(t *testing.T) {
+	tests := []struct {
+		path    string
+		name    string
+		version string
+	}{
+		{"external/pypi_attrs/file/attrs-18.1.0-py2.py3-none-any.whl", "attrs", "18.1.0"},
+		{"numpy-1.14.2-cp27-cp27mu-manylinux1_x86_64.whl", "numpy", "1.14.2"},
+		{"weird.whl", "weird", ""},
+	}
+	for _, test := range tests {
+		name, version := wheelNameVersion(test.path)
+		if name != test.name || version != test.version {
+			t.Errorf("wheelNameVersion(%#v)=%#v, %#v; expected %#v, %#v",
+				test.path, name, version, test.name, test.version)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	sources := newSourceMap()
+	sources.AddSource("mypkg/foo.py", "mypkg/foo.py")
+	sources.AddSource("mypkg/gen.py", "bazel-out/k8-fastbuild/bin/mypkg/gen.py")
+	sources.AddSource("mypkg/gen2.py", "bazel-out/darwin-opt/genfiles/mypkg/gen2.py")
+	sources.AddSource("ext.py", "external/repo/ext.py")
+	index := sources.AddWheel("six-1.11.0-py2.py3-none-any.whl")
+	sources.AddWheelFile("six.py", index)
+
+	expected := &sourceMap{
+		map[string]string{
+			"mypkg/foo.py":  "mypkg/foo.py",
+			"mypkg/gen.py":  "mypkg/gen.py",
+			"mypkg/gen2.py": "mypkg/gen2.py",
+			"ext.py":        "external/repo/ext.py",
+		},
+		map[string]int{"six.py": 0},
+		[]string{"six-1.11.0"},
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("sources=%#v; expected %#v", sources, expected)
+	}
+}
@@ -0,0 +1,30 @@
+package simplepack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Checks the init modules, default environment and default args in m.
+func validateStartup(m *Manifest) error {
+	for _, initModule := range m.InitModules {
+		err := validateModuleEntryPoint(initModule)
+		if err != nil {
+			return fmt.Errorf("init_modules: %s", err.Error())
+		}
+	}
+	for key := range m.DefaultEnv {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("default_env: invalid variable name %#v", key)
+		}
+	}
+	return nil
+}
+
+// Returns a Python dict literal of values.
+func pythonStringDict(values map[string]string) string {
+	if values == nil {
+		values = map[string]string{}
+	}
+	return pythonLiteral(values)
+}
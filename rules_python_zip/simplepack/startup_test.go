@@ -0,0 +1,39 @@
+package simplepack
+
+import "testing"
+
+func TestValidateStartup(t *testing.T) {
+	valid := &Manifest{
+		InitModules: []string{"gevent.monkey:patch_all", "mypkg.logging_setup"},
+		DefaultEnv:  map[string]string{"TZ": "UTC", "EMPTY": ""},
+		DefaultArgs: []string{"--flag=it's"},
+	}
+	err := validateStartup(valid)
+	if err != nil {
+		t.Error(err)
+	}
+
+	invalid := []*Manifest{
+		{InitModules: []string{"mypkg:"}},
+		{InitModules: []string{"import os"}},
+		{DefaultEnv: map[string]string{"": "x"}},
+		{DefaultEnv: map[string]string{"A=B": "x"}},
+	}
+	for _, m := range invalid {
+		if validateStartup(m) == nil {
+			t.Errorf("validateStartup(%#v)=nil; expected error", m)
+		}
+	}
+}
+
+func TestPythonStringDict(t *testing.T) {
+	output := pythonStringDict(map[string]string{"b": "it's", "a": "x\ny", "c": "<&>"})
+	expected := `{"a":"x\ny","b":"it's","c":"<&>"}`
+	if output != expected {
+		t.Errorf("pythonStringDict()=%s; expected %s", output, expected)
+	}
+	output = pythonStringDict(nil)
+	if output != "{}" {
+		t.Errorf("pythonStringDict(nil)=%s; expected {}", output)
+	}
+}
@@ -0,0 +1,85 @@
+package simplepack
+
+import "strings"
+
+// Top-level module names in the standard library of Python 2.7, including built in modules.
+var python2Stdlib = newStringSet(`
+	__builtin__ __future__ __main__ _abcoll _ast _bisect _codecs _collections _csv _ctypes
+	_functools _hashlib _heapq _io _json _locale _lsprof _md5 _multibytecodec _multiprocessing
+	_osx_support _random _sha _sha256 _sha512 _socket _sqlite3 _sre _ssl _strptime _struct
+	_sysconfigdata _threading_local _warnings _weakref _weakrefset _winreg abc aifc anydbm
+	argparse array ast asynchat asyncore atexit audiodev audioop base64 BaseHTTPServer Bastion bdb
+	binascii binhex bisect bsddb bz2 calendar cgi CGIHTTPServer cgitb chunk cmath cmd code codecs
+	codeop collections colorsys commands compileall compiler ConfigParser contextlib Cookie
+	cookielib copy copy_reg cPickle cProfile crypt cStringIO csv ctypes curses datetime dbhash dbm
+	decimal difflib dircache dis distutils doctest DocXMLRPCServer dumbdbm dummy_thread
+	dummy_threading email encodings ensurepip errno exceptions fcntl filecmp fileinput fnmatch
+	formatter fpectl fractions ftplib functools future_builtins gc gdbm genericpath getopt getpass
+	gettext glob grp gzip hashlib heapq hmac hotshot htmlentitydefs htmllib HTMLParser httplib
+	idlelib ihooks imaplib imghdr imp importlib imputil inspect io itertools json keyword lib2to3
+	linecache locale logging macpath macurl2path mailbox mailcap markupbase marshal math md5 mhlib
+	mimetools mimetypes MimeWriter mimify mmap modulefinder msilib msvcrt multifile
+	multiprocessing mutex netrc new nis nntplib ntpath nturl2path numbers opcode operator optparse
+	os os2emxpath ossaudiodev parser pdb pickle pickletools pipes pkgutil platform plistlib popen2
+	poplib posix posixfile posixpath pprint profile pstats pty pwd py_compile pyclbr pydoc
+	pydoc_data pyexpat Queue quopri random re readline repr resource rexec rfc822 rlcompleter
+	robotparser runpy sched ScrolledText select sets sgmllib sha shelve shlex shutil signal
+	SimpleHTTPServer SimpleXMLRPCServer site smtpd smtplib sndhdr socket SocketServer spwd sqlite3
+	sre sre_compile sre_constants sre_parse ssl stat statvfs string StringIO stringold stringprep
+	strop struct subprocess sunau sunaudio symbol symtable sys sysconfig syslog tabnanny tarfile
+	telnetlib tempfile termios test textwrap this thread threading time timeit Tix tkColorChooser
+	tkCommonDialog tkFileDialog tkFont Tkinter tkMessageBox tkSimpleDialog toaiff token tokenize
+	trace traceback ttk tty turtle types unicodedata unittest urllib urllib2 urlparse user
+	UserDict UserList UserString uu uuid warnings wave weakref webbrowser whichdb winsound wsgiref
+	xdrlib xml xmllib xmlrpclib xxsubtype zipfile zipimport zlib
+`)
+
+// Top-level module names in the standard library of any Python 3 release, including modules
+// that were removed in later versions.
+var python3Stdlib = newStringSet(`
+	__future__ _abc _aix_support _ast _asyncio _bisect _blake2 _bootsubprocess _bz2 _codecs
+	_codecs_cn _codecs_hk _codecs_iso2022 _codecs_jp _codecs_kr _codecs_tw _collections
+	_collections_abc _compat_pickle _compression _contextvars _crypt _csv _ctypes _curses
+	_curses_panel _datetime _dbm _decimal _dummy_thread _elementtree _frozen_importlib
+	_frozen_importlib_external _functools _gdbm _hashlib _heapq _imp _io _json _locale _lsprof
+	_lzma _markupbase _md5 _msi _multibytecodec _multiprocessing _opcode _operator _osx_support
+	_overlapped _pickle _posixshmem _posixsubprocess _py_abc _pydecimal _pyio _queue _random
+	_scproxy _sha1 _sha256 _sha3 _sha512 _signal _sitebuiltins _socket _sqlite3 _sre _ssl _stat
+	_statistics _string _strptime _struct _symtable _thread _threading_local _tkinter _tokenize
+	_tracemalloc _typing _uuid _warnings _weakref _weakrefset _winapi _zoneinfo abc aifc
+	antigravity argparse array ast asynchat asyncio asyncore atexit audioop base64 bdb binascii
+	binhex bisect builtins bz2 calendar cgi cgitb chunk cmath cmd code codecs codeop collections
+	colorsys compileall concurrent configparser contextlib contextvars copy copyreg cProfile crypt
+	csv ctypes curses dataclasses datetime dbm decimal difflib dis distutils doctest
+	dummy_threading email encodings ensurepip enum errno faulthandler fcntl filecmp fileinput
+	fnmatch formatter fractions ftplib functools gc genericpath getopt getpass gettext glob
+	graphlib grp gzip hashlib heapq hmac html http idlelib imaplib imghdr imp importlib inspect io
+	ipaddress itertools json keyword lib2to3 linecache locale logging lzma macpath mailbox mailcap
+	marshal math mimetypes mmap modulefinder msilib msvcrt multiprocessing netrc nis nntplib nt
+	ntpath nturl2path numbers opcode operator optparse os ossaudiodev parser pathlib pdb pickle
+	pickletools pipes pkgutil platform plistlib poplib posix posixpath pprint profile pstats pty
+	pwd py_compile pyclbr pydoc pydoc_data pyexpat queue quopri random re readline reprlib
+	resource rlcompleter runpy sched secrets select selectors shelve shlex shutil signal site
+	smtpd smtplib sndhdr socket socketserver spwd sqlite3 sre_compile sre_constants sre_parse ssl
+	stat statistics string stringprep struct subprocess sunau symbol symtable sys sysconfig syslog
+	tabnanny tarfile telnetlib tempfile termios test textwrap this threading time timeit tkinter
+	token tokenize tomllib trace traceback tracemalloc tty turtle turtledemo types typing
+	unicodedata unittest urllib uu uuid venv warnings wave weakref webbrowser winreg winsound
+	wsgiref xdrlib xml xmlrpc zipapp zipfile zipimport zlib zoneinfo
+`)
+
+func newStringSet(names string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range strings.Fields(names) {
+		set[name] = true
+	}
+	return set
+}
+
+// Returns the set of standard library top-level modules for a Python version like "2.7" or "3".
+func stdlibModules(pythonVersion string) map[string]bool {
+	if strings.HasPrefix(pythonVersion, "2") {
+		return python2Stdlib
+	}
+	return python3Stdlib
+}
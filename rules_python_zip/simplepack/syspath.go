@@ -0,0 +1,80 @@
+package simplepack
+
+import "fmt"
+
+// Values for SysPathPolicy.Isolation
+const (
+	// Removes site-packages and the Mac OS X Extras directories
+	isolationDefault = ""
+	// Also removes dist-packages and the user site directory
+	isolationStrict = "strict"
+	// Keeps all of the host's paths
+	isolationNone = "none"
+)
+
+// Interpreter flags that can be set with SysPathPolicy.InterpreterFlags
+var isolationFlags = map[string]bool{"-E": true, "-I": true, "-s": true}
+
+// Controls which paths of the host Python installation are visible to code in the zip.
+type SysPathPolicy struct {
+	Isolation string
+	// Paths to keep on sys.path even though they would be removed, and everything below them
+	AllowPaths []string `json:"allow_paths"`
+	// Distributions installed on the host that can be imported, even though their path is
+	// removed. Only their top-level modules are importable.
+	AllowDistributions []string `json:"allow_distributions"`
+	// Flags the interpreter must run with, e.g. "-I". The zip re-executes itself if needed.
+	InterpreterFlags []string `json:"interpreter_flags"`
+}
+
+func (p *SysPathPolicy) validate() error {
+	switch p.Isolation {
+	case isolationDefault, isolationStrict, isolationNone:
+	default:
+		return fmt.Errorf("invalid sys_path isolation: %#v", p.Isolation)
+	}
+	for _, flag := range p.InterpreterFlags {
+		if !isolationFlags[flag] {
+			return fmt.Errorf("invalid sys_path interpreter flag: %#v", flag)
+		}
+	}
+	return nil
+}
+
+// Returns the substrings that identify paths of the host installation.
+func (p *SysPathPolicy) markers() []string {
+	switch p.Isolation {
+	case isolationNone:
+		return []string{}
+	case isolationStrict:
+		return []string{"/site-packages", "/dist-packages", "/Extras/lib/python"}
+	}
+	return []string{"/site-packages", "/Extras/lib/python"}
+}
+
+// Template arguments for the sys.path policy, as Python literals.
+type sysPathArgs struct {
+	Markers            string
+	RemoveUserSite     bool
+	AllowPaths         string
+	AllowDistributions string
+	InterpreterFlags   string
+}
+
+// Returns a Python list literal of values.
+func pythonStringList(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	return pythonLiteral(values)
+}
+
+func newSysPathArgs(p *SysPathPolicy) *sysPathArgs {
+	args := &sysPathArgs{pythonStringList(p.markers()), p.Isolation == isolationStrict,
+		pythonStringList(p.AllowPaths), pythonStringList(p.AllowDistributions), ""}
+	// empty when there are no flags, so the template can skip re-executing
+	if len(p.InterpreterFlags) > 0 {
+		args.InterpreterFlags = pythonStringList(p.InterpreterFlags)
+	}
+	return args
+}
@@ -0,0 +1,42 @@
+package simplepack
+
+import "testing"
+
+func TestSysPathPolicyValidate(t *testing.T) {
+	valid := []SysPathPolicy{
+		{},
+		{Isolation: isolationStrict, InterpreterFlags: []string{"-I", "-s", "-E"}},
+		{Isolation: isolationNone, AllowPaths: []string{"/opt/sdk"}},
+	}
+	for _, policy := range valid {
+		err := policy.validate()
+		if err != nil {
+			t.Errorf("validate(%#v)=%s; expected nil", policy, err)
+		}
+	}
+	invalid := []SysPathPolicy{
+		{Isolation: "everything"},
+		{InterpreterFlags: []string{"-u"}},
+	}
+	for _, policy := range invalid {
+		if policy.validate() == nil {
+			t.Errorf("validate(%#v)=nil; expected error", policy)
+		}
+	}
+}
+
+func TestNewSysPathArgs(t *testing.T) {
+	args := newSysPathArgs(&SysPathPolicy{})
+	expected := sysPathArgs{`["/site-packages","/Extras/lib/python"]`, false, `[]`, `[]`, ""}
+	if *args != expected {
+		t.Errorf("newSysPathArgs(default)=%#v; expected %#v", *args, expected)
+	}
+
+	args = newSysPathArgs(&SysPathPolicy{isolationStrict, []string{"/opt/it's", "/opt/R&D"},
+		[]string{"vendor-sdk"}, []string{"-I"}})
+	expected = sysPathArgs{`["/site-packages","/dist-packages","/Extras/lib/python"]`, true,
+		`["/opt/it's","/opt/R&D"]`, `["vendor-sdk"]`, `["-I"]`}
+	if *args != expected {
+		t.Errorf("newSysPathArgs(strict)=%#v; expected %#v", *args, expected)
+	}
+}
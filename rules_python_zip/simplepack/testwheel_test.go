@@ -0,0 +1,51 @@
+package simplepack
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+// Returns a wheel of files, name to contents. The entries are sorted by name so the bytes do not
+// depend on the map order.
+func testWheelBytes(t *testing.T, files map[string]string) []byte {
+	out := &bytes.Buffer{}
+	zw := zip.NewWriter(out)
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// Writes a wheel of files to path.
+func writeTestWheel(t *testing.T, path string, files map[string]string) {
+	err := ioutil.WriteFile(path, testWheelBytes(t, files), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the entries of a wheel of files, as if it was opened from path.
+func testWheelContents(t *testing.T, path string, files map[string]string) *wheelContents {
+	data := testWheelBytes(t, files)
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wheelContents{path, reader.File, false, nil}
+}
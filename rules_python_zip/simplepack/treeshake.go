@@ -0,0 +1,291 @@
+package simplepack
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Finds the files that cannot be reached by following imports from the entry point.
+type treeShaker struct {
+	pythonVersion string
+	keep          []string
+	paths         []string
+	imports       map[string][]pyImport
+}
+
+func newTreeShaker(pythonVersion string, keep []string) *treeShaker {
+	return &treeShaker{pythonVersion, keep, nil, map[string][]pyImport{}}
+}
+
+// Adds a path that will be written to the zip.
+func (t *treeShaker) AddPath(filePath string) {
+	t.paths = append(t.paths, filePath)
+}
+
+func (t *treeShaker) Scan(filePath string, data []byte) {
+	if !strings.HasSuffix(filePath, ".py") {
+		return
+	}
+	t.imports[filePath] = parsePythonImports(data)
+}
+
+// Returns the module name for a Python file, e.g. "a.b" for "a/b/__init__.py".
+func pyFileModule(filePath string) string {
+	module := filePath[:strings.LastIndex(filePath, ".")]
+	module = strings.TrimSuffix(module, "/__init__")
+	return strings.Replace(module, "/", ".", -1)
+}
+
+func (t *treeShaker) isKept(module string) bool {
+	for _, pattern := range t.keep {
+		if module == pattern || strings.HasPrefix(module, pattern+".") {
+			return true
+		}
+		if matched, _ := path.Match(pattern, module); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the reachable modules starting from roots, which are module names.
+func (t *treeShaker) reachable(roots []string) map[string]bool {
+	modules := moduleNames(t.paths)
+	moduleFiles := map[string]string{}
+	for filePath := range t.imports {
+		moduleFiles[pyFileModule(filePath)] = filePath
+	}
+	isPython2 := strings.HasPrefix(t.pythonVersion, "2")
+
+	reached := map[string]bool{}
+	queue := []string{}
+	visit := func(module string) {
+		// importing a.b.c imports a and a.b; it might also be a name defined in a.b
+		for module != "" && !modules[module] {
+			lastDot := strings.LastIndex(module, ".")
+			if lastDot < 0 {
+				return
+			}
+			module = module[:lastDot]
+		}
+		for module != "" && !reached[module] {
+			reached[module] = true
+			queue = append(queue, module)
+			lastDot := strings.LastIndex(module, ".")
+			if lastDot < 0 {
+				break
+			}
+			module = module[:lastDot]
+		}
+	}
+
+	for _, root := range roots {
+		visit(root)
+	}
+	for module := range modules {
+		if t.isKept(module) {
+			visit(module)
+		}
+	}
+	for len(queue) > 0 {
+		module := queue[0]
+		queue = queue[1:]
+		filePath, exists := moduleFiles[module]
+		if !exists {
+			continue
+		}
+		pkg := containingPackage(filePath)
+		for _, imp := range t.imports[filePath] {
+			candidates := []string{absoluteModule(filePath, imp.Module)}
+			if isPython2 && candidates[0] == imp.Module && pkg != "" {
+				candidates = append(candidates, pkg+"."+imp.Module)
+			}
+			for _, candidate := range candidates {
+				if candidate == "" {
+					continue
+				}
+				visit(candidate)
+				for _, name := range imp.Names {
+					if modules[candidate+"."+name] {
+						visit(candidate + "." + name)
+					}
+				}
+			}
+		}
+	}
+	return reached
+}
+
+// Returns the paths that can be dropped from the zip, given the root modules and paths that
+// must be kept.
+func (t *treeShaker) Dropped(roots []string, keepPaths []string) []string {
+	for _, keepPath := range keepPaths {
+		if isPyFile(keepPath) {
+			roots = append(roots, pyFileModule(keepPath))
+		}
+	}
+	reached := t.reachable(roots)
+	keepPathSet := map[string]bool{}
+	for _, keepPath := range keepPaths {
+		keepPathSet[keepPath] = true
+	}
+	reachedTopLevel := map[string]bool{}
+	for module := range reached {
+		reachedTopLevel[strings.SplitN(module, ".", 2)[0]] = true
+	}
+
+	dropped := []string{}
+	for _, filePath := range t.paths {
+		if keepPathSet[filePath] {
+			continue
+		}
+		if isPyFile(filePath) {
+			if !reached[pyFileModule(filePath)] {
+				dropped = append(dropped, filePath)
+			}
+			continue
+		}
+		// keep resources that belong to a reached top-level package, root files and metadata
+		parts := strings.SplitN(filePath, "/", 2)
+		if len(parts) == 1 || reachedTopLevel[parts[0]] {
+			continue
+		}
+		if strings.HasSuffix(parts[0], ".dist-info") || strings.HasSuffix(parts[0], ".egg-info") {
+			continue
+		}
+		dropped = append(dropped, filePath)
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// What tree shaking the sources and wheels of a manifest found.
+type treeShakeResult struct {
+	// Paths that are not packed, sorted, and as a set
+	DroppedPaths []string
+	Dropped      map[string]bool
+	// Contents of the Python files that were read, by path in the zip, so packing does not
+	// read them again
+	Contents map[string][]byte
+}
+
+// Reads the sources in m and wheels and returns the paths that tree shaking drops.
+func treeShakeManifest(m *Manifest, wheels []*wheelContents) (*treeShakeResult, error) {
+	shaker := newTreeShaker(m.targetPythonVersion(), m.TreeShakeKeep)
+	// finds the packages that are unzipped because they are not zip safe
+	var zipSafety *zipSafetyScanner
+	if m.ZipSafetyCheck == zipSafetyUnzip {
+		zipSafety = newZipSafetyScanner(m.ZipSafetyIgnore)
+	}
+	contents := map[string][]byte{}
+	allPaths := []string{}
+	for _, sourceMeta := range m.Sources {
+		shaker.AddPath(sourceMeta.Dst)
+		allPaths = append(allPaths, sourceMeta.Dst)
+		if !strings.HasSuffix(sourceMeta.Dst, ".py") {
+			continue
+		}
+		data, err := ioutil.ReadFile(sourceMeta.Src)
+		if err != nil {
+			return nil, err
+		}
+		contents[sourceMeta.Dst] = data
+		shaker.Scan(sourceMeta.Dst, data)
+		if zipSafety != nil {
+			zipSafety.Scan(sourceMeta.Dst, data)
+		}
+	}
+
+	keepPaths := []string{}
+	forceUnzipWheels := map[string]bool{}
+	for _, forceUnzipPath := range m.ForceUnzip {
+		if strings.HasSuffix(forceUnzipPath, ".whl") {
+			forceUnzipWheels[forceUnzipPath] = true
+		} else {
+			keepPaths = append(keepPaths, forceUnzipPath)
+		}
+	}
+	for _, wheel := range wheels {
+		for _, wheelF := range wheel.Files {
+			pathWithinOutputZip := wheel.OutputPath(wheelF)
+			shaker.AddPath(pathWithinOutputZip)
+			allPaths = append(allPaths, pathWithinOutputZip)
+			if forceUnzipWheels[wheel.Path] {
+				keepPaths = append(keepPaths, pathWithinOutputZip)
+			}
+			if !strings.HasSuffix(pathWithinOutputZip, ".py") {
+				continue
+			}
+			data, err := readZipFile(wheelF)
+			if err != nil {
+				return nil, err
+			}
+			contents[pathWithinOutputZip] = data
+			shaker.Scan(pathWithinOutputZip, data)
+			if zipSafety != nil {
+				zipSafety.Scan(pathWithinOutputZip, data)
+			}
+		}
+	}
+	// everything unzipped at startup must be in the zip
+	keepPaths = append(keepPaths, computedUnzipPaths(m, allPaths, zipSafety)...)
+
+	var roots []string
+	if len(m.EntryPoints) > 0 {
+		for _, name := range sortedCommandNames(m.EntryPoints) {
+			entryPoint := m.EntryPoints[name]
+			if isScriptEntryPoint(entryPoint) {
+				roots = append(roots, pyFileModule(entryPoint))
+			} else {
+				roots = append(roots, entryPointModule(entryPoint))
+			}
+		}
+	} else if m.EntryPoint != "" {
+		roots = []string{entryPointModule(m.EntryPoint)}
+	} else {
+		roots = []string{pyFileModule(m.Sources[0].Dst)}
+	}
+	for _, initModule := range m.InitModules {
+		roots = append(roots, entryPointModule(initModule))
+	}
+	dropped := shaker.Dropped(roots, keepPaths)
+	droppedSet := map[string]bool{}
+	for _, droppedPath := range dropped {
+		droppedSet[droppedPath] = true
+		delete(contents, droppedPath)
+	}
+	return &treeShakeResult{dropped, droppedSet, contents}, nil
+}
+
+// Writes the list of dropped paths, one per line.
+func writeTreeShakeReport(w io.Writer, dropped []string) error {
+	_, err := fmt.Fprintf(w, "# tree shaking dropped %d files\n", len(dropped))
+	if err != nil {
+		return err
+	}
+	for _, droppedPath := range dropped {
+		_, err = fmt.Fprintln(w, droppedPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTreeShakeReportFile(reportPath string, dropped []string) error {
+	f, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+	err = writeTreeShakeReport(f, dropped)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,81 @@
+package simplepack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTreeShakerDropped(t *testing.T) {
+	files := map[string]string{
+		"main.py":                  "import used.a\nfrom lib import helper\n",
+		"used/__init__.py":         "",
+		"used/a.py":                "from . import b\nfrom .c import name\n",
+		"used/b.py":                "",
+		"used/c.py":                "",
+		"used/unused.py":           "import unusedlib\n",
+		"used/data.json":           "",
+		"lib/__init__.py":          "",
+		"lib/helper.py":            "",
+		"lib/other.py":             "",
+		"unusedlib/__init__.py":    "",
+		"unusedlib/resource.txt":   "",
+		"plugins/__init__.py":      "",
+		"plugins/p1.py":            "import pluginhelper\n",
+		"pluginhelper.py":          "",
+		"forced/x.py":              "",
+		"lib-1.0.dist-info/RECORD": "",
+		"README.txt":               "",
+	}
+	shaker := newTreeShaker("3", []string{"plugins.*"})
+	for filePath, contents := range files {
+		shaker.AddPath(filePath)
+		shaker.Scan(filePath, []byte(contents))
+	}
+	dropped := shaker.Dropped([]string{"main"}, []string{"forced/x.py"})
+	expected := []string{
+		"lib/other.py",
+		"unusedlib/__init__.py",
+		"unusedlib/resource.txt",
+		"used/unused.py",
+	}
+	if !reflect.DeepEqual(dropped, expected) {
+		t.Errorf("Dropped()=%#v; expected %#v", dropped, expected)
+	}
+
+	out := &bytes.Buffer{}
+	err := writeTreeShakeReport(out, dropped[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "# tree shaking dropped 1 files\nlib/other.py\n" {
+		t.Errorf("unexpected report: %#v", out.String())
+	}
+}
+
+func TestTreeShakeManifestKeepsUnzipPaths(t *testing.T) {
+	wheel := testWheelContents(t, "wheels/deps-1.0-py3-none-any.whl", map[string]string{
+		"main.py":              "import used\n",
+		"used.py":              "",
+		"native/__init__.py":   "",
+		"native/_speedups.so":  "",
+		"native/cert.pem":      "",
+		"unsafe/__init__.py":   "",
+		"unsafe/data.py":       "open(os.path.join(os.path.dirname(__file__), 'x'))\n",
+		"unused/__init__.py":   "",
+		"unused/resource.json": "",
+	})
+	m := &Manifest{EntryPoint: "main", ZipSafetyCheck: zipSafetyUnzip, PythonVersion: "3"}
+	shaken, err := treeShakeManifest(m, []*wheelContents{wheel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"native/__init__.py", "unused/__init__.py", "unused/resource.json"}
+	if !reflect.DeepEqual(shaken.DroppedPaths, expected) {
+		t.Errorf("treeShakeManifest()=%#v; expected %#v", shaken.DroppedPaths, expected)
+	}
+	// packing reuses the Python files that are kept
+	if string(shaken.Contents["main.py"]) != "import used\n" || shaken.Contents["unused/__init__.py"] != nil {
+		t.Errorf("Contents=%#v; expected the kept Python files", shaken.Contents)
+	}
+}
@@ -0,0 +1,122 @@
+package simplepack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Value for Manifest.ZipSafetyCheck in addition to the check modes: unzip unsafe packages
+const zipSafetyUnzip = "unzip"
+
+// Patterns in Python source that usually mean the code expects to find real files next to
+// itself. These are heuristics: they only look at a single line at a time.
+var zipUnsafePatterns = []struct {
+	re          *regexp.Regexp
+	description string
+}{
+	{regexp.MustCompile(`\b(?:io\.|codecs\.)?open\(.*__file__`), "open() relative to __file__"},
+	{regexp.MustCompile(`\bos\.(?:listdir|walk|scandir)\(.*__file__`),
+		"directory listing relative to __file__"},
+	{regexp.MustCompile(`\bglob\.i?glob\(.*__file__`), "glob relative to __file__"},
+	{regexp.MustCompile(`\bresource_filename\(`), "pkg_resources.resource_filename"},
+	{regexp.MustCompile(`\b(?:CDLL|PyDLL|LoadLibrary)\(.*(?:__file__|['"](?:\.\.?/|[^/'"][^'"]*/))`),
+		"ctypes library loaded from a relative path"},
+}
+
+type zipSafetyFinding struct {
+	Path        string
+	Line        int
+	Description string
+}
+
+func (f zipSafetyFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Description)
+}
+
+// Scans Python source files for code that is likely to break when run from inside a zip.
+type zipSafetyScanner struct {
+	ignore   []string
+	findings []zipSafetyFinding
+}
+
+func newZipSafetyScanner(ignore []string) *zipSafetyScanner {
+	return &zipSafetyScanner{ignore, nil}
+}
+
+// Returns true if path is suppressed by the ignore list. Entries are either path.Match
+// patterns or directory prefixes.
+func (s *zipSafetyScanner) isIgnored(filePath string) bool {
+	for _, pattern := range s.ignore {
+		if matched, _ := path.Match(pattern, filePath); matched {
+			return true
+		}
+		if strings.HasPrefix(filePath, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Scans the Python source in data, which will be stored at filePath.
+func (s *zipSafetyScanner) Scan(filePath string, data []byte) {
+	if !strings.HasSuffix(filePath, ".py") || s.isIgnored(filePath) {
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// some generated files have extremely long lines
+	scanner.Buffer(nil, len(data)+1)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, pattern := range zipUnsafePatterns {
+			if pattern.re.MatchString(line) {
+				s.findings = append(s.findings,
+					zipSafetyFinding{filePath, lineNumber, pattern.description})
+				break
+			}
+		}
+	}
+}
+
+func (s *zipSafetyScanner) Findings() []zipSafetyFinding {
+	return s.findings
+}
+
+// Returns the top-level packages or modules containing findings, e.g. "certifi" for
+// "certifi/core.py" or "six.py" for a root module.
+func (s *zipSafetyScanner) UnsafePackages() []string {
+	packages := map[string]bool{}
+	for _, finding := range s.findings {
+		packages[strings.SplitN(finding.Path, "/", 2)[0]] = true
+	}
+	out := []string{}
+	for pkg := range packages {
+		out = append(out, pkg)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Returns the paths that belong to any of the packages returned by UnsafePackages.
+func (s *zipSafetyScanner) UnzipPaths(paths []string) []string {
+	packages := s.UnsafePackages()
+	out := []string{}
+	for _, filePath := range paths {
+		for _, pkg := range packages {
+			if filePath == pkg || strings.HasPrefix(filePath, pkg+"/") {
+				out = append(out, filePath)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package simplepack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZipSafetyScanner(t *testing.T) {
+	source := `import os
+# open(os.path.join(os.path.dirname(__file__), 'commented.txt'))
+DATA = open(os.path.join(os.path.dirname(__file__), 'data.txt')).read()
+FILES = os.listdir(os.path.dirname(__file__))
+lib = ctypes.CDLL('libc.so.6')
+native = ctypes.CDLL('./_native.so')
+cert = pkg_resources.resource_filename(__name__, 'cacert.pem')
+`
+	scanner := newZipSafetyScanner(nil)
+	scanner.Scan("pkg/core.py", []byte(source))
+	scanner.Scan("pkg/data.txt", []byte(source))
+	scanner.Scan("other.py", []byte("import os\nprint(__file__)\n"))
+
+	lines := []int{}
+	for _, finding := range scanner.Findings() {
+		if finding.Path != "pkg/core.py" {
+			t.Errorf("unexpected finding in %s", finding)
+		}
+		lines = append(lines, finding.Line)
+	}
+	expected := []int{3, 4, 6, 7}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("finding lines=%#v; expected %#v", lines, expected)
+	}
+
+	packages := scanner.UnsafePackages()
+	if !reflect.DeepEqual(packages, []string{"pkg"}) {
+		t.Errorf("UnsafePackages()=%#v", packages)
+	}
+	paths := []string{"other.py", "pkg/__init__.py", "pkg/core.py", "pkg/data.txt", "pkgother/a.py"}
+	unzipPaths := scanner.UnzipPaths(paths)
+	expectedPaths := []string{"pkg/__init__.py", "pkg/core.py", "pkg/data.txt"}
+	if !reflect.DeepEqual(unzipPaths, expectedPaths) {
+		t.Errorf("UnzipPaths(%#v)=%#v; expected %#v", paths, unzipPaths, expectedPaths)
+	}
+}
+
+func TestZipSafetyScannerIgnore(t *testing.T) {
+	source := []byte("DATA = open(__file__ + '.txt')\n")
+	scanner := newZipSafetyScanner([]string{"ignored", "globbed/*.py"})
+	scanner.Scan("ignored/sub/a.py", source)
+	scanner.Scan("globbed/b.py", source)
+	scanner.Scan("ignoredother/c.py", source)
+	findings := scanner.Findings()
+	if len(findings) != 1 || findings[0].Path != "ignoredother/c.py" {
+		t.Errorf("findings=%#v; expected only ignoredother/c.py", findings)
+	}
+}
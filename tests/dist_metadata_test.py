@@ -0,0 +1,64 @@
+import sys
+import types
+import unittest
+import zipfile
+
+import pkg_resources
+
+
+class TestDistributionMetadata(unittest.TestCase):
+    def test_pkg_resources(self):
+        dist = pkg_resources.get_distribution('pytest')
+        self.assertEqual(pkg_resources.DEVELOP_DIST, dist.precedence)
+        scripts = [ep.name for ep in pkg_resources.iter_entry_points('console_scripts')]
+        self.assertIn('py.test', scripts)
+
+    def test_importlib_metadata(self):
+        if sys.version_info < (3, 8):
+            return
+        import importlib.metadata
+        self.assertEqual(pkg_resources.get_distribution('pytest').version,
+                         importlib.metadata.version('pytest'))
+
+    def test_importlib_metadata_backport(self):
+        '''The importlib_metadata backport works without zipfile.Path, which is new in 3.8: the
+        finder must use the zipp backport instead.'''
+        import pyz_runtime.metadata
+
+        class FakePath(object):
+            def __init__(self, root, at=''):
+                self.root = root
+                self.at = at
+
+        class Context(object):
+            name = 'pytest'
+            path = sys.path
+
+        fake_zipp = types.ModuleType('zipp')
+        fake_zipp.Path = FakePath
+        fake_backport = types.ModuleType('importlib_metadata')
+        fake_backport.PathDistribution = lambda path: path
+        modules = ('zipp', 'importlib_metadata', 'importlib.metadata')
+        saved_modules = dict((name, sys.modules.get(name)) for name in modules)
+        saved_path = getattr(zipfile, 'Path', None)
+        sys.modules['zipp'] = fake_zipp
+        sys.modules['importlib_metadata'] = fake_backport
+        # makes "import importlib.metadata" raise ImportError
+        sys.modules['importlib.metadata'] = None
+        if saved_path is not None:
+            del zipfile.Path
+        try:
+            finder = pyz_runtime.metadata.DistributionFinder()
+            dists = list(finder.find_distributions(Context()))
+        finally:
+            for name, module in saved_modules.items():
+                if module is None:
+                    del sys.modules[name]
+                else:
+                    sys.modules[name] = module
+            if saved_path is not None:
+                zipfile.Path = saved_path
+        self.assertEqual(1, len(dists))
+        self.assertIsInstance(dists[0], FakePath)
+        self.assertTrue(dists[0].at.startswith('pytest-'), dists[0].at)
+        self.assertTrue(dists[0].at.endswith('.dist-info/'), dists[0].at)
@@ -0,0 +1,10 @@
+import sys
+import time
+
+import pyz_runtime._zip
+
+
+print(pyz_runtime._zip.extract_dir)
+sys.stdout.flush()
+if len(sys.argv) > 1:
+    time.sleep(float(sys.argv[1]))
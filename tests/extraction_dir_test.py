@@ -0,0 +1,57 @@
+import os
+import shutil
+import signal
+import subprocess
+import tempfile
+import unittest
+
+
+BUILT_PATH = os.path.join(os.path.dirname(__file__), 'extraction_dir')
+
+
+class TestExtractionDir(unittest.TestCase):
+    def setUp(self):
+        self.root = tempfile.mkdtemp()
+        self.env = dict(os.environ)
+        self.env['PYZ_TMPDIR'] = self.root
+
+    def tearDown(self):
+        shutil.rmtree(self.root)
+
+    def start(self):
+        process = subprocess.Popen((BUILT_PATH, '60'), stdout=subprocess.PIPE, env=self.env)
+        extract_dir = process.stdout.readline().decode().strip()
+        self.assertEqual(self.root, os.path.dirname(extract_dir))
+        self.assertTrue(os.path.exists(os.path.join(extract_dir, '.pyz_lock')))
+        return process, extract_dir
+
+    def test_exit(self):
+        output = subprocess.check_output((BUILT_PATH,), env=self.env)
+        self.assertEqual(self.root, os.path.dirname(output.decode().strip()))
+        self.assertEqual([], os.listdir(self.root))
+
+    def test_signals(self):
+        for signum in (signal.SIGHUP, signal.SIGTERM):
+            process, extract_dir = self.start()
+            process.send_signal(signum)
+            process.wait()
+            self.assertEqual(-signum, process.returncode)
+            self.assertFalse(os.path.exists(extract_dir))
+
+    def test_keyboard_interrupt(self):
+        process, extract_dir = self.start()
+        process.send_signal(signal.SIGINT)
+        process.wait()
+        # Python 3.8 and later exit with SIGINT after a KeyboardInterrupt
+        self.assertIn(process.returncode, (1, -signal.SIGINT))
+        self.assertFalse(os.path.exists(extract_dir))
+
+    def test_stale_cleanup(self):
+        process, extract_dir = self.start()
+        process.kill()
+        process.wait()
+        self.assertTrue(os.path.exists(extract_dir))
+
+        # the next run removes the directory of the killed process
+        subprocess.check_output((BUILT_PATH,), env=self.env)
+        self.assertEqual([], os.listdir(self.root))
@@ -0,0 +1,9 @@
+import os
+import sys
+
+import tests.init_modules_setup
+
+
+print('configured: %s' % tests.init_modules_setup.configured)
+print('argv: %s' % ' '.join(sys.argv[1:]))
+print('env: %s %s' % (os.environ['INIT_MODULES_DEFAULT'], os.environ['INIT_MODULES_OVERRIDE']))
@@ -0,0 +1,8 @@
+import os
+
+# set by configure(), which must run before the entry point
+configured = []
+
+
+def configure():
+    configured.append(os.environ['INIT_MODULES_DEFAULT'])
@@ -0,0 +1,18 @@
+import os
+import subprocess
+import unittest
+
+
+BUILT_PATH = os.path.join(os.path.dirname(__file__), 'init_modules')
+
+
+class TestInitModules(unittest.TestCase):
+    def test_init_modules(self):
+        env = dict(os.environ)
+        env['INIT_MODULES_OVERRIDE'] = 'from process'
+        output = subprocess.check_output((BUILT_PATH, 'arg'), env=env)
+        expected = '''configured: ['default']
+argv: --default-arg arg
+env: default from process
+'''
+        self.assertEqual(expected, output.decode())
@@ -37,28 +37,65 @@ class TestPyzInterpreter(unittest.TestCase):
             stdin_file.seek(0)
 
         # prefixed with python
-        output = subprocess.check_output(('python', _INTERPRETER_PATH,) + args,
+        output = subprocess.check_output(('python', _INTERPRETER_PATH,) + args, stdin=stdin_file,
             stderr=subprocess.STDOUT)
         self.assertIn(expect_in_output, output)
 
-        if stdin_file is not None:
-            stdin_file.seek(0)
-
         # unzipped
         tempdir = tempfile.mkdtemp()
         try:
             zf = zipfile.ZipFile(_INTERPRETER_PATH)
             zf.extractall(tempdir)
-            output = subprocess.check_output(('python', tempdir) + args, stderr=subprocess.STDOUT)
+            if stdin_file is not None:
+                stdin_file.seek(0)
+            output = subprocess.check_output(('python', tempdir) + args, stdin=stdin_file,
+                stderr=subprocess.STDOUT)
             self.assertIn(expect_in_output, output)
 
         finally:
             shutil.rmtree(tempdir)     
 
-    def test_interactive(self):
-        # should work when directly executed, executed with Python, or unzipped
-        self.run_with_args_and_expect(tuple(), '(InteractiveConsole)',
-            stdin_data='import google.cloud.datastore')
+    def run_and_expect_exit(self, args, expect_code, expect_in_output):
+        process = subprocess.Popen((_INTERPRETER_PATH,) + args, stdout=subprocess.PIPE,
+            stderr=subprocess.STDOUT)
+        output = process.communicate()[0]
+        self.assertEqual(expect_code, process.returncode)
+        self.assertIn(expect_in_output, output)
+
+    def test_stdin(self):
+        # like python: stdin that is not a terminal is read as a script
+        self.run_with_args_and_expect(tuple(), 'stdin script',
+            stdin_data='import google.cloud.datastore\nprint "stdin script"\n')
+        self.run_with_args_and_expect(('-', 'arg'), "['-', 'arg']",
+            stdin_data='import sys\nprint sys.argv\n')
+
+    def test_inspect(self):
+        self.run_with_args_and_expect(('-i', '-c', 'x = 42'), '42', stdin_data='print x\n')
+
+    def test_command(self):
+        self.run_with_args_and_expect(
+            ('-c', 'import google.cloud.datastore, sys; print sys.argv', 'arg'), "['-c', 'arg']")
+
+    def test_module(self):
+        self.run_with_args_and_expect(('-m', 'google.cloud.datastore.helpers'), '')
+        self.run_and_expect_exit(('-m', 'does_not_exist'), 1, 'No module named')
+
+    def test_exit_codes(self):
+        self.run_and_expect_exit(('-c', 'import sys; sys.exit(3)'), 3, '')
+        self.run_and_expect_exit(('-c', '1/0'), 1, 'ZeroDivisionError')
+        self.run_and_expect_exit(('does_not_exist.py',), 2, "can't open file")
+        self.run_and_expect_exit(('-Z',), 2, 'Unknown option: -Z')
+        self.run_and_expect_exit(('--version',), 0, 'Python ')
+
+    def test_warnings(self):
+        self.run_and_expect_exit(('-W', 'error', '-c', 'import warnings; warnings.warn("x")'),
+            1, 'UserWarning')
+
+    def test_source_encoding(self):
+        script = tempfile.NamedTemporaryFile()
+        script.write('# -*- coding: latin-1 -*-\nprint repr(u"caf\xe9")\n')
+        script.flush()
+        self.run_with_args_and_expect((script.name,), "u'caf\\xe9'")
    
     def test_script(self):
         script = tempfile.NamedTemporaryFile()
@@ -0,0 +1,10 @@
+import sys
+
+
+def main():
+    print('function %s' % ' '.join(sys.argv[1:]))
+    return 3
+
+
+if __name__ == '__main__':
+    print('module %s' % ' '.join(sys.argv[1:]))
@@ -0,0 +1,3 @@
+import sys
+
+print('script %s' % ' '.join(sys.argv[1:]))
@@ -0,0 +1,37 @@
+import os
+import shutil
+import subprocess
+import tempfile
+import unittest
+
+
+BUILT_PATH = os.path.abspath(os.path.join(os.path.dirname(__file__), 'multicall'))
+
+
+def run(args):
+    process = subprocess.Popen(args, stdout=subprocess.PIPE, stderr=subprocess.PIPE)
+    stdout, stderr = process.communicate()
+    return process.returncode, stdout.decode(), stderr.decode()
+
+
+class TestMulticall(unittest.TestCase):
+    def test_subcommand(self):
+        self.assertEqual((0, 'script a b\n', ''), run((BUILT_PATH, 'script', 'a', 'b')))
+        self.assertEqual((0, 'module c\n', ''), run((BUILT_PATH, 'module', 'c')))
+        self.assertEqual((3, 'function d\n', ''), run((BUILT_PATH, 'function', 'd')))
+
+    def test_symlink(self):
+        tempdir = tempfile.mkdtemp()
+        try:
+            link_path = os.path.join(tempdir, 'function')
+            os.symlink(BUILT_PATH, link_path)
+            self.assertEqual((3, 'function e\n', ''), run((link_path, 'e')))
+        finally:
+            shutil.rmtree(tempdir)
+
+    def test_unknown_command(self):
+        code, stdout, stderr = run((BUILT_PATH, 'unknown'))
+        self.assertEqual(2, code)
+        self.assertEqual('', stdout)
+        self.assertIn('unknown command: unknown', stderr)
+        self.assertIn('\n  function\n  module\n  script\n', stderr)
@@ -0,0 +1,22 @@
+from __future__ import print_function
+
+import os
+
+from pyz_runtime import resources
+
+
+def main():
+    print('read_bytes', resources.read_bytes('tests', 'resource.txt').decode().strip())
+    print('open_text', resources.open_text('tests', 'resource.txt').read().strip())
+    print('listdir', 'resource.txt' in resources.listdir('tests'))
+    path = resources.filename('tests', 'resource.txt')
+    with open(path) as f:
+        print('filename', os.path.isfile(path), f.read().strip())
+    try:
+        resources.read_bytes('tests', 'does_not_exist.txt')
+    except IOError:
+        print('missing IOError')
+
+
+if __name__ == '__main__':
+    main()
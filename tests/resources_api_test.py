@@ -0,0 +1,30 @@
+import os
+import shutil
+import subprocess
+import tempfile
+import unittest
+import zipfile
+
+
+BUILT_PATH = os.path.join(os.path.dirname(__file__), 'resources_api')
+EXPECTED_OUTPUT = '''read_bytes hello resource.txt
+open_text hello resource.txt
+listdir True
+filename True hello resource.txt
+missing IOError
+'''
+
+
+class TestResourcesAPI(unittest.TestCase):
+    def test_execute_zipped(self):
+        output = subprocess.check_output((BUILT_PATH,))
+        self.assertEqual(EXPECTED_OUTPUT, output.decode())
+
+    def test_execute_unzipped(self):
+        tempdir = tempfile.mkdtemp()
+        try:
+            zipfile.ZipFile(BUILT_PATH).extractall(tempdir)
+            output = subprocess.check_output(('python', tempdir))
+            self.assertEqual(EXPECTED_OUTPUT, output.decode())
+        finally:
+            shutil.rmtree(tempdir)
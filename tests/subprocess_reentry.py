@@ -0,0 +1,22 @@
+import multiprocessing
+import subprocess
+import sys
+
+import tests.subprocess_reentry_child
+
+
+def main():
+    sys.stdout.write(subprocess.check_output(('reentry-child', 'a', 'b')).decode())
+    sys.stdout.write(subprocess.check_output(
+        ('pyz-python', '-c', 'import tests.subprocess_reentry_child; print("python")')).decode())
+    if sys.version_info >= (3, 4):
+        pool = multiprocessing.get_context('spawn').Pool(2)
+    else:
+        pool = multiprocessing.Pool(2)
+    print(pool.map(tests.subprocess_reentry_child.square, (1, 2, 3)))
+    pool.close()
+    pool.join()
+
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,9 @@
+import sys
+
+
+def main():
+    print('child ' + ' '.join(sys.argv[1:]))
+
+
+def square(x):
+    return x * x
@@ -0,0 +1,12 @@
+import os
+import subprocess
+import unittest
+
+
+BUILT_PATH = os.path.join(os.path.dirname(__file__), 'subprocess_reentry')
+
+
+class TestSubprocessReentry(unittest.TestCase):
+    def test_reentry(self):
+        output = subprocess.check_output((BUILT_PATH, 'reentry'))
+        self.assertEqual('child a b\npython\n[1, 4, 9]\n', output.decode())
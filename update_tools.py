@@ -8,25 +8,28 @@ GOOS_TO_BAZEL = {
     'linux': 'linux',
 }
 
-GO_TOOL_SRC = ('rules_python_zip/simplepack.go', 'pypi/pip_generate.go')
+# main package directory and tool name
+GO_TOOLS = (('rules_python_zip', 'simplepack'), ('pypi', 'pip_generate'))
 
 # TODO: Build 32-bit versions?
 GOARCH = 'amd64'
 
 
 def main():
-    script_dir = os.path.dirname(__file__)
+    script_dir = os.path.dirname(os.path.abspath(__file__))
 
-    for src in GO_TOOL_SRC:
+    for package_dir, tool_name in GO_TOOLS:
         for goos, bazel_os in GOOS_TO_BAZEL.items():
-            tool_name = os.path.splitext(os.path.basename(src))[0]
             output = os.path.join(script_dir, 'tools',
                                   '%s-x64-%s' % (tool_name, bazel_os))
             env = dict(os.environ)
             env['GOOS'] = goos
             env['GOARCH'] = GOARCH
-            command = ('go', 'build', '-o', output, src)
-            subprocess.check_call(command, env=env)
+            # the tools are committed with the sources they are built from: the VCS stamp
+            # would name the previous commit, and paths would differ between checkouts
+            command = ['go', 'build', '-trimpath', '-buildvcs=false', '-o', output,
+                       './' + package_dir]
+            subprocess.check_call(command, env=env, cwd=script_dir)
             print(output)
 
 